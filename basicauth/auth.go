@@ -1,10 +1,13 @@
 package basicauth
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -24,6 +27,8 @@ var (
 type Config struct {
 	Auth  func(username, password string) bool
 	Realm string
+	// Guard, if not nil, limits failed attempts.
+	Guard *Guard
 }
 
 func auth(config *Config, chdr, shdr string, code int, ck *contextKey) func(http.Handler) http.Handler {
@@ -35,10 +40,38 @@ func auth(config *Config, chdr, shdr string, code int, ck *contextKey) func(http
 			header := req.Header.Get(chdr)
 			defer req.Header.Del(chdr)
 
-			username, password, ok := Decode(header)
-			if !ok || !config.Auth(username, password) {
+			challenge := func() {
 				rw.Header().Set(shdr, `Basic realm="`+config.Realm+`"`)
 				rw.WriteHeader(code)
+			}
+			if header == "" {
+				// Clients usually send a request without the header before
+				// they are challenged, which is neither a failure nor worth
+				// checking credentials for. They don't touch Guard, as they
+				// cost no more than the challenge.
+				challenge()
+				return
+			}
+
+			// Auth is called even if the header is malformed, so that the
+			// time taken doesn't tell a malformed header from wrong
+			// credentials.
+			username, password, ok := Decode(header)
+			var done func(ok bool)
+			if guard := config.Guard; guard != nil {
+				var d time.Duration
+				if d, done = guard.attempt(req, username); d > 0 {
+					rw.Header().Set("Retry-After", strconv.Itoa(int((d+time.Second-1)/time.Second)))
+					rw.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+			}
+			ok = config.Auth(username, password) && ok
+			if done != nil {
+				done(ok)
+			}
+			if !ok {
+				challenge()
 				return
 			}
 
@@ -62,17 +95,22 @@ func Encode(username, password string) string {
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
 }
 
+// Decode decodes the credentials of the Basic scheme in s. It does the
+// same work for malformed credentials as for well-formed ones, and returns
+// empty strings if ok is false.
 func Decode(s string) (username, password string, ok bool) {
+	var scheme, credentials string
 	ss := strings.Fields(s)
-	if len(ss) != 2 || ss[0] != "Basic" {
-		return
+	if len(ss) > 0 {
+		scheme = ss[0]
 	}
-	b, err := base64.StdEncoding.DecodeString(ss[1])
-	if err != nil {
-		return
+	if len(ss) > 1 {
+		credentials = ss[1]
 	}
-	if ss = strings.SplitN(string(b), ":", 2); len(ss) != 2 {
-		return
+	b, err := base64.StdEncoding.DecodeString(credentials)
+	i := bytes.IndexByte(b, ':')
+	if len(ss) != 2 || scheme != "Basic" || err != nil || i < 0 {
+		return "", "", false
 	}
-	return ss[0], ss[1], true
+	return string(b[:i]), string(b[i+1:]), true
 }
@@ -0,0 +1,325 @@
+package basicauth
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The password hashes supported in htpasswd files.
+const (
+	hashUnknown = iota
+	hashBcrypt  // $2y$, $2a$ or $2b$
+	hashSHA1    // {SHA}
+	hashAPR1    // $apr1$
+	hashMD5     // $1$
+	hashSHA256  // $5$
+	hashSHA512  // $6$
+	hashDES     // traditional crypt(3)
+)
+
+func hashKind(h string) int {
+	switch {
+	case strings.HasPrefix(h, "$2"):
+		return hashBcrypt
+	case strings.HasPrefix(h, "{SHA}"):
+		return hashSHA1
+	case strings.HasPrefix(h, "$apr1$"):
+		return hashAPR1
+	case strings.HasPrefix(h, "$1$"):
+		return hashMD5
+	case strings.HasPrefix(h, "$5$"):
+		return hashSHA256
+	case strings.HasPrefix(h, "$6$"):
+		return hashSHA512
+	case len(h) == 13 && strings.Trim(h, itoa64) == "":
+		return hashDES
+	}
+	return hashUnknown
+}
+
+// cost returns the rank of the kind of h by the work to verify it, and the
+// cost parameter of h within the kind. Hashes compare by rank, then by n.
+func cost(h string) (rank, n int) {
+	switch kind := hashKind(h); kind {
+	case hashBcrypt:
+		n, _ = bcrypt.Cost([]byte(h))
+		return 6, n
+	case hashSHA512, hashSHA256:
+		n = 5000
+		if rest := h[3:]; strings.HasPrefix(rest, "rounds=") {
+			if i := strings.IndexByte(rest, '$'); i >= 0 {
+				if r, err := strconv.Atoi(rest[len("rounds="):i]); err == nil {
+					n = r
+				}
+			}
+		}
+		if kind == hashSHA512 {
+			return 5, n
+		}
+		return 4, n
+	case hashAPR1, hashMD5:
+		return 3, 0
+	case hashDES:
+		return 2, 0
+	case hashSHA1:
+		return 1, 0
+	}
+	return 0, 0
+}
+
+// verify reports whether password matches the hash h. The computed hash is
+// compared in constant time.
+func verify(h, password string) bool {
+	var computed string
+	switch hashKind(h) {
+	case hashBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil
+	case hashSHA1:
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case hashAPR1:
+		computed = md5Crypt(password, h, "$apr1$")
+	case hashMD5:
+		computed = md5Crypt(password, h, "$1$")
+	case hashSHA256:
+		computed = shaCrypt(password, h, "$5$", sha256.New, sha256Order)
+	case hashSHA512:
+		computed = shaCrypt(password, h, "$6$", sha512.New, sha512Order)
+	case hashDES:
+		computed = desCrypt(password, h)
+	default:
+		return false
+	}
+	return constantTimeCompare([]byte(computed), []byte(h)) == 1
+}
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// b64 appends the n least significant 6-bit groups of v to buf, least
+// significant first.
+func b64(buf []byte, v uint, n int) []byte {
+	for ; n > 0; n-- {
+		buf = append(buf, itoa64[v&0x3f])
+		v >>= 6
+	}
+	return buf
+}
+
+// salt returns the salt in setting, which follows magic and ends at the
+// next '$', truncated to n bytes.
+func salt(setting, magic string, n int) string {
+	s := strings.TrimPrefix(setting, magic)
+	if i := strings.IndexByte(s, '$'); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) > n {
+		s = s[:n]
+	}
+	return s
+}
+
+// md5Crypt implements the MD5-based crypt of FreeBSD, and its variant of
+// Apache with the magic "$apr1$".
+func md5Crypt(password, setting, magic string) string {
+	var (
+		pw = []byte(password)
+		s  = []byte(salt(setting, magic, 8))
+	)
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write(s)
+	alt.Write(pw)
+	sum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic))
+	ctx.Write(s)
+	for n := len(pw); n > 0; n -= 16 {
+		if n > 16 {
+			ctx.Write(sum)
+		} else {
+			ctx.Write(sum[:n])
+		}
+	}
+	for i := len(pw); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	sum = ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		ctx := md5.New()
+		if i&1 != 0 {
+			ctx.Write(pw)
+		} else {
+			ctx.Write(sum)
+		}
+		if i%3 != 0 {
+			ctx.Write(s)
+		}
+		if i%7 != 0 {
+			ctx.Write(pw)
+		}
+		if i&1 != 0 {
+			ctx.Write(sum)
+		} else {
+			ctx.Write(pw)
+		}
+		sum = ctx.Sum(nil)
+	}
+
+	buf := make([]byte, 0, len(magic)+len(s)+23)
+	buf = append(buf, magic...)
+	buf = append(buf, s...)
+	buf = append(buf, '$')
+	for _, i := range [...][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		buf = b64(buf, uint(sum[i[0]])<<16|uint(sum[i[1]])<<8|uint(sum[i[2]]), 4)
+	}
+	return string(b64(buf, uint(sum[11]), 2))
+}
+
+// The order of the bytes of the digests in the output of shaCrypt. A
+// negative index stands for a zero byte.
+var (
+	sha256Order = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+		{-1, 31, 30},
+	}
+	sha512Order = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41}, {-1, -1, 63},
+	}
+)
+
+// shaCrypt implements the SHA-256 and SHA-512 based crypt of glibc.
+func shaCrypt(password, setting, magic string, newHash func() hash.Hash, order [][3]int) string {
+	const prefix = "rounds="
+	var (
+		pw     = []byte(password)
+		rest   = strings.TrimPrefix(setting, magic)
+		rounds = 5000
+		custom bool
+	)
+	if strings.HasPrefix(rest, prefix) {
+		if i := strings.IndexByte(rest, '$'); i >= 0 {
+			if n, err := strconv.ParseUint(rest[len(prefix):i], 10, 32); err == nil {
+				rounds, custom, rest = int(n), true, rest[i+1:]
+				if rounds < 1000 {
+					rounds = 1000
+				} else if rounds > 999999999 {
+					rounds = 999999999
+				}
+			}
+		}
+	}
+	s := []byte(salt(rest, "", 16))
+
+	h := newHash()
+	h.Write(pw)
+	h.Write(s)
+	h.Write(pw)
+	alt := h.Sum(nil)
+
+	h.Reset()
+	h.Write(pw)
+	h.Write(s)
+	repeat(h, alt, len(pw))
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write(alt)
+		} else {
+			h.Write(pw)
+		}
+	}
+	sum := h.Sum(nil)
+
+	h.Reset()
+	for i := 0; i < len(pw); i++ {
+		h.Write(pw)
+	}
+	p := sequence(h.Sum(nil), len(pw))
+
+	h.Reset()
+	for i := 0; i < 16+int(sum[0]); i++ {
+		h.Write(s)
+	}
+	ss := sequence(h.Sum(nil), len(s))
+
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write(ss)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(sum)
+		} else {
+			h.Write(p)
+		}
+		sum = h.Sum(sum[:0])
+	}
+
+	buf := make([]byte, 0, 128)
+	buf = append(buf, magic...)
+	if custom {
+		buf = append(buf, prefix...)
+		buf = strconv.AppendInt(buf, int64(rounds), 10)
+		buf = append(buf, '$')
+	}
+	buf = append(buf, s...)
+	buf = append(buf, '$')
+	for _, o := range order {
+		var v uint
+		n := 4
+		for _, i := range o {
+			v <<= 8
+			if i >= 0 {
+				v |= uint(sum[i])
+			} else {
+				n--
+			}
+		}
+		buf = b64(buf, v, n)
+	}
+	return string(buf)
+}
+
+// repeat writes n bytes of b repeated to h.
+func repeat(h hash.Hash, b []byte, n int) {
+	for ; n > len(b); n -= len(b) {
+		h.Write(b)
+	}
+	h.Write(b[:n])
+}
+
+// sequence returns n bytes of b repeated.
+func sequence(b []byte, n int) []byte {
+	seq := make([]byte, 0, n)
+	for ; n > len(b); n -= len(b) {
+		seq = append(seq, b...)
+	}
+	return append(seq, b[:n]...)
+}
@@ -0,0 +1,292 @@
+package basicauth
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Guard protects against brute-force attacks by counting failed attempts
+// per username and per client IP. After the free attempts of a counter,
+// each failure blocks further attempts for an exponentially growing delay,
+// and enough failures lock the counter out for a while. Blocked attempts
+// are answered with 429 Too Many Requests and a Retry-After header,
+// without checking the credentials. An attempt that the failure of
+// concurrent attempts would block waits for them instead of being checked
+// at the same time.
+//
+// Note that the username counter lets anyone lock a user out by failing on
+// purpose, which the IP counter alone doesn't.
+type Guard struct {
+	// User and IP configure the counters per username and per client IP.
+	// A nil policy disables the counter.
+	User *Policy
+	IP   *Policy
+	// Store keeps the counters. The default is a MemoryStore of
+	// DefaultStoreSize counters.
+	Store Store
+	// ClientIP returns the IP of the client of req. The default is the
+	// host of req.RemoteAddr, which should be replaced behind proxies.
+	ClientIP func(req *http.Request) string
+	// Audit, if not nil, is called for each attempt and lockout.
+	Audit func(e *Event)
+
+	mu      sync.Mutex // serializes updates of counters
+	cond    *sync.Cond // signaled when an attempt is done
+	pending map[string]int
+	once    sync.Once
+}
+
+// Policy configures a failure counter of Guard.
+type Policy struct {
+	// FreeAttempts is the number of failures allowed without delay.
+	FreeAttempts int
+	// Backoff is the delay after the first failure beyond FreeAttempts,
+	// which doubles with each further failure up to MaxBackoff. The
+	// defaults are 1 second and 5 minutes.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// LockoutAfter, if greater than 0, is the number of failures that
+	// locks the counter out for Lockout, which defaults to 15 minutes.
+	LockoutAfter int
+	Lockout      time.Duration
+	// ResetAfter is how long failures are counted after the last one. The
+	// default is an hour.
+	ResetAfter time.Duration
+}
+
+// Record is the state of a counter.
+type Record struct {
+	Failures     int
+	Last         time.Time // the time of the last failure
+	BlockedUntil time.Time
+}
+
+type EventType int
+
+const (
+	EventSuccess EventType = iota // valid credentials
+	EventFailure                  // invalid credentials
+	EventBlocked                  // an attempt while blocked
+	EventLockout                  // a failure that locks a counter out
+)
+
+var eventTypes = [...]string{"success", "failure", "blocked", "lockout"}
+
+func (t EventType) String() string {
+	if int(t) < len(eventTypes) {
+		return eventTypes[t]
+	}
+	return "unknown"
+}
+
+// Event describes an attempt for auditing.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Username string
+	ClientIP string
+	// UserFailures and IPFailures are the failures counted so far.
+	UserFailures int
+	IPFailures   int
+	// RetryAfter is how long the client is blocked.
+	RetryAfter time.Duration
+	Request    *http.Request
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
+func (p *Policy) locks(failures int) bool {
+	return p.LockoutAfter > 0 && failures >= p.LockoutAfter
+}
+
+// delay returns how long attempts are blocked after failures.
+func (p *Policy) delay(failures int) time.Duration {
+	if p.locks(failures) {
+		return orDefault(p.Lockout, 15*time.Minute)
+	}
+	n := failures - p.FreeAttempts
+	if n <= 0 {
+		return 0
+	}
+	d, max := orDefault(p.Backoff, time.Second), orDefault(p.MaxBackoff, 5*time.Minute)
+	for ; n > 1 && d < max; n-- {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// counter is a counter of an attempt.
+type counter struct {
+	policy *Policy
+	key    string
+	record Record
+}
+
+// counters returns the counters of an attempt at t, which are reset if
+// they have expired.
+func (g *Guard) counters(t time.Time, username, ip string) []counter {
+	g.once.Do(func() {
+		if g.Store == nil {
+			g.Store = NewMemoryStore(DefaultStoreSize)
+		}
+		g.cond = sync.NewCond(&g.mu)
+		g.pending = make(map[string]int)
+	})
+	var cs []counter
+	if g.User != nil && username != "" {
+		cs = append(cs, counter{policy: g.User, key: "user:" + username})
+	}
+	if g.IP != nil && ip != "" {
+		cs = append(cs, counter{policy: g.IP, key: "ip:" + ip})
+	}
+	for i := range cs {
+		c := &cs[i]
+		r, ok := g.Store.Get(c.key)
+		if ok && (t.Sub(r.Last) <= orDefault(c.policy.ResetAfter, time.Hour) || t.Before(r.BlockedUntil)) {
+			c.record = r
+		}
+	}
+	return cs
+}
+
+func (g *Guard) clientIP(req *http.Request) string {
+	if g.ClientIP != nil {
+		return g.ClientIP(req)
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+func (g *Guard) event(typ EventType, t time.Time, req *http.Request, username, ip string, cs []counter) *Event {
+	e := &Event{Type: typ, Time: t, Username: username, ClientIP: ip, Request: req}
+	for _, c := range cs {
+		if c.policy == g.User {
+			e.UserFailures = c.record.Failures
+		} else {
+			e.IPFailures = c.record.Failures
+		}
+		if d := c.record.BlockedUntil.Sub(t); d > e.RetryAfter {
+			e.RetryAfter = d
+		}
+	}
+	return e
+}
+
+func (g *Guard) audit(e *Event) {
+	if g.Audit != nil {
+		g.Audit(e)
+	}
+}
+
+// attempt checks an attempt of username from the client of req. It returns
+// how long the attempt is blocked, or 0 and a function to call with whether
+// the credentials are valid. An attempt that would be blocked if the
+// attempts in progress failed waits for them, so that concurrent attempts
+// can't all pass the check before any of them fails.
+func (g *Guard) attempt(req *http.Request, username string) (time.Duration, func(ok bool)) {
+	ip := g.clientIP(req)
+	g.mu.Lock()
+	t, cs := g.wait(username, ip)
+	if e := g.event(EventBlocked, t, req, username, ip, cs); e.RetryAfter > 0 {
+		g.mu.Unlock()
+		g.audit(e)
+		return e.RetryAfter, nil
+	}
+	for _, c := range cs {
+		g.pending[c.key]++
+	}
+	g.mu.Unlock()
+
+	return 0, func(ok bool) {
+		if ok {
+			g.succeed(req, username, ip, cs)
+		} else {
+			g.fail(req, username, ip, cs)
+		}
+	}
+}
+
+// wait waits until no attempt in progress can block an attempt of username
+// from ip, and returns the time and the counters of the attempt. g.mu must
+// be held.
+func (g *Guard) wait(username, ip string) (time.Time, []counter) {
+	for {
+		t := now()
+		cs := g.counters(t, username, ip)
+		contended := false
+		for _, c := range cs {
+			if n := g.pending[c.key]; n > 0 && c.policy.delay(c.record.Failures+n) > 0 {
+				contended = true
+			}
+		}
+		if !contended {
+			return t, cs
+		}
+		g.cond.Wait()
+	}
+}
+
+// done marks the attempt of the counters cs as done.
+func (g *Guard) done(cs []counter) {
+	for _, c := range cs {
+		if g.pending[c.key]--; g.pending[c.key] == 0 {
+			delete(g.pending, c.key)
+		}
+	}
+	g.cond.Broadcast()
+}
+
+// fail counts a failed attempt.
+func (g *Guard) fail(req *http.Request, username, ip string, cs []counter) {
+	var lockout bool
+	g.mu.Lock()
+	g.done(cs)
+	t := now()
+	cs = g.counters(t, username, ip)
+	for i := range cs {
+		c := &cs[i]
+		c.record.Failures++
+		c.record.Last = t
+		if d := c.policy.delay(c.record.Failures); d > 0 {
+			c.record.BlockedUntil = t.Add(d)
+		}
+		lockout = lockout || c.policy.locks(c.record.Failures)
+		g.Store.Put(c.key, c.record)
+	}
+	g.mu.Unlock()
+
+	g.audit(g.event(EventFailure, t, req, username, ip, cs))
+	if lockout {
+		g.audit(g.event(EventLockout, t, req, username, ip, cs))
+	}
+}
+
+// succeed resets the counter of username. The counter of the client IP is
+// kept, so that a valid account doesn't help guessing others.
+func (g *Guard) succeed(req *http.Request, username, ip string, cs []counter) {
+	g.mu.Lock()
+	g.done(cs)
+	t := now()
+	cs = g.counters(t, "", ip)
+	if g.User != nil {
+		g.Store.Delete("user:" + username)
+	}
+	g.mu.Unlock()
+
+	g.audit(g.event(EventSuccess, t, req, username, ip, cs))
+}
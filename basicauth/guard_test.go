@@ -0,0 +1,192 @@
+package basicauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	p := &Policy{FreeAttempts: 2, Backoff: time.Second, MaxBackoff: 5 * time.Second, LockoutAfter: 8, Lockout: time.Hour}
+	want := []time.Duration{0, 0, 0, 1, 2, 4, 5, 5, 3600, 3600}
+	for failures, w := range want {
+		if got := p.delay(failures); got != w*time.Second {
+			t.Errorf("delay(%d) = %v, want %v", failures, got, w*time.Second)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(2)
+	s.Put("a", Record{Failures: 1})
+	s.Put("b", Record{Failures: 2})
+	s.Get("a")
+	s.Put("c", Record{Failures: 3}) // evicts b
+	if _, ok := s.Get("b"); ok {
+		t.Errorf("Get(b) after eviction: got ok")
+	}
+	if r, ok := s.Get("a"); !ok || r.Failures != 1 {
+		t.Errorf("Get(a) = %v, %v, want 1 failure", r, ok)
+	}
+	s.Put("c", Record{Failures: 4})
+	if r, _ := s.Get("c"); r.Failures != 4 {
+		t.Errorf("Get(c) = %v, want 4 failures", r)
+	}
+	s.Delete("a")
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", s.Len())
+	}
+}
+
+func TestGuard(t *testing.T) {
+	defer func() { now = time.Now }()
+	clock := time.Unix(1e9, 0)
+	now = func() time.Time { return clock }
+
+	var events []string
+	config := &Config{
+		Realm: "Basic Auth",
+		Auth:  Users(map[string]string{"foo": "bar", "baz": "qux"}),
+		Guard: &Guard{
+			User: &Policy{FreeAttempts: 2, Backoff: time.Second, LockoutAfter: 5, Lockout: time.Minute},
+			IP:   &Policy{FreeAttempts: 7, Backoff: time.Second, ResetAfter: time.Hour},
+			Audit: func(e *Event) {
+				events = append(events, e.Type.String()+" "+e.Username)
+			},
+		},
+	}
+	handler := Auth(config)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	do := func(ip, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		if header != "" {
+			req.Header.Set(HeaderAuthorization, header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	check := func(name string, rec *httptest.ResponseRecorder, code int, retry string) {
+		t.Helper()
+		if rec.Code != code || rec.Header().Get("Retry-After") != retry {
+			t.Errorf("%s: got %v Retry-After %q, want %v %q", name, rec.Code, rec.Header().Get("Retry-After"), code, retry)
+		}
+	}
+	wrong, right := Encode("foo", "wrong"), Encode("foo", "bar")
+
+	for i := 0; i < 3; i++ {
+		check("missing header", do("10.0.0.1", ""), 401, "")
+	}
+	check("failure 1", do("10.0.0.1", wrong), 401, "")
+	check("failure 2", do("10.0.0.2", wrong), 401, "")
+	check("failure 3", do("10.0.0.3", wrong), 401, "")
+	check("backoff", do("10.0.0.4", right), 429, "1")
+	check("other user", do("10.0.0.4", Encode("baz", "qux")), 200, "")
+
+	clock = clock.Add(time.Second)
+	check("failure 4", do("10.0.0.1", wrong), 401, "")
+	check("backoff doubled", do("10.0.0.1", right), 429, "2")
+	clock = clock.Add(2 * time.Second)
+	check("failure 5", do("10.0.0.1", wrong), 401, "")
+	check("lockout", do("10.0.0.5", right), 429, "60")
+	clock = clock.Add(time.Minute)
+	check("after lockout", do("10.0.0.5", right), 200, "")
+	check("reset by success", do("10.0.0.5", wrong), 401, "")
+
+	// A sprayer trying a password for many users is stopped by the
+	// counter of its IP, which has counted 3 failures above.
+	for i, u := range []string{"a", "b", "c", "d"} {
+		check("spray "+u, do("10.0.0.1", Encode(u, "123456")), 401, "")
+		if i == 0 {
+			check("spray", do("10.0.0.1", "Basic !"), 401, "")
+		}
+	}
+	check("IP backoff", do("10.0.0.1", Encode("e", "123456")), 429, "1")
+	clock = clock.Add(2 * time.Hour)
+	check("IP reset", do("10.0.0.1", Encode("e", "123456")), 401, "")
+
+	want := []string{
+		"failure foo", "failure foo", "failure foo", "blocked foo", "success baz",
+		"failure foo", "blocked foo", "failure foo", "lockout foo", "blocked foo",
+		"success foo", "failure foo",
+		"failure a", "failure ", "failure b", "failure c", "failure d", "blocked e",
+		"failure e",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events:\n got %q\nwant %q", events, want)
+	}
+}
+
+func TestGuardConcurrent(t *testing.T) {
+	var calls int32
+	config := &Config{
+		Auth: func(username, password string) bool {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(10 * time.Millisecond)
+			return false
+		},
+		Guard: &Guard{
+			User: &Policy{FreeAttempts: 2, Backoff: time.Minute},
+		},
+	}
+	handler := Auth(config)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+			req.Header.Set(HeaderAuthorization, Encode("foo", "wrong"))
+			<-start
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n > 3 {
+		t.Errorf("Auth called %d times, want at most 3", n)
+	}
+}
+
+func TestGuardConcurrentValid(t *testing.T) {
+	users := Users(map[string]string{"foo": "bar"})
+	config := &Config{
+		Auth: func(username, password string) bool {
+			time.Sleep(time.Millisecond)
+			return users(username, password)
+		},
+		Guard: &Guard{User: &Policy{}, IP: &Policy{}},
+	}
+	handler := Auth(config)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(HeaderAuthorization, Encode("foo", "bar"))
+			rec := httptest.NewRecorder()
+			<-start
+			handler.ServeHTTP(rec, req)
+			codes[i] = rec.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: got %d, want 200", i, code)
+		}
+	}
+}
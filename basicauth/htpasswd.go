@@ -0,0 +1,178 @@
+package basicauth
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Htpasswd authenticates users with the password hashes in an htpasswd
+// file of Apache. The supported hashes are bcrypt ("$2y$", "$2a$" and
+// "$2b$"), SHA-1 ("{SHA}"), MD5 of Apache ("$apr1$") and the variants of
+// crypt(3): MD5 ("$1$"), SHA-256 ("$5$"), SHA-512 ("$6$") and DES. Plain
+// text passwords are not supported.
+//
+// The file can be reloaded while Auth is being called, e.g.
+//
+//	h, err := basicauth.LoadHtpasswd("/etc/app/htpasswd")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer h.Watch(10*time.Second, func(err error) { log.Print(err) })()
+//	auth := basicauth.Auth(&basicauth.Config{Auth: h.Auth, Realm: "app"})
+type Htpasswd struct {
+	path  string
+	users atomic.Value // *credentials
+
+	mu      sync.Mutex // serializes Reload
+	modTime time.Time
+	size    int64
+}
+
+// LoadHtpasswd loads the htpasswd file at path.
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	h := &Htpasswd{path: path}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload reloads the file. The users are replaced at once, and they are
+// kept if the file can't be loaded.
+func (h *Htpasswd) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.reload()
+}
+
+func (h *Htpasswd) reload() error {
+	fi, err := os.Stat(h.path)
+	if err != nil {
+		return fmt.Errorf("basicauth: %v", err)
+	}
+	b, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		return fmt.Errorf("basicauth: %v", err)
+	}
+	users, err := parseHtpasswd(b)
+	if err != nil {
+		return fmt.Errorf("basicauth: %s:%v", h.path, err)
+	}
+	h.users.Store(users)
+	h.modTime, h.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+// DefaultWatchInterval is the interval of Watch if it's not positive.
+const DefaultWatchInterval = 10 * time.Second
+
+// Watch checks the file for changes of its modification time or size
+// every interval, and reloads it if it has changed. Errors are reported to
+// onError, which can be nil. It returns a function that stops watching;
+// onError isn't called after the function returns.
+func (h *Htpasswd) Watch(interval time.Duration, onError func(error)) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	var (
+		ticker  = time.NewTicker(interval)
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
+		once    sync.Once
+	)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if err := h.check(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+func (h *Htpasswd) check() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fi, err := os.Stat(h.path)
+	if err != nil {
+		return fmt.Errorf("basicauth: %v", err)
+	}
+	if fi.ModTime().Equal(h.modTime) && fi.Size() == h.size {
+		return nil
+	}
+	return h.reload()
+}
+
+// Auth reports whether the password of username matches the file. It can
+// be used as Config.Auth.
+func (h *Htpasswd) Auth(username, password string) bool {
+	c := h.users.Load().(*credentials)
+	hash, ok := c.hashes[username]
+	if !ok {
+		// Verify the password anyway, so unknown usernames take at least
+		// as long as wrong passwords.
+		hash = c.dummy
+	}
+	return verify(hash, password) && ok
+}
+
+type credentials struct {
+	hashes map[string]string
+	// dummy is the hash of the file that takes the longest to verify,
+	// which is verified for unknown usernames.
+	dummy string
+}
+
+func costlier(rank, n int, h string) bool {
+	r, m := cost(h)
+	return rank > r || rank == r && n > m
+}
+
+// parseHtpasswd parses lines of "username:hash". Blank lines and lines
+// starting with '#' are ignored.
+func parseHtpasswd(b []byte) (*credentials, error) {
+	c := &credentials{hashes: make(map[string]string)}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("%d: missing username or password", n)
+		}
+		username, hash := line[:i], line[i+1:]
+		if hashKind(hash) == hashUnknown {
+			return nil, fmt.Errorf("%d: unsupported password hash for %q", n, username)
+		}
+		if _, ok := c.hashes[username]; ok {
+			return nil, fmt.Errorf("%d: duplicate user %q", n, username)
+		}
+		c.hashes[username] = hash
+		if r, n := cost(hash); c.dummy == "" || costlier(r, n, c.dummy) {
+			c.dummy = hash
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,125 @@
+package basicauth
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"bcrypt", "$2a$04$9xyw3iDypoJf09iTqmHwYeHWFmgGJ.I2wbYxqxhk39LQf0klsqTPy"},
+		{"sha1", "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+		{"apr1", "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/"},
+		{"md5", "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/"},
+		{"sha256", "$5$saltsalt$gOjOtoMpVhru2uyjeJSEc/JaLQWOXMNmlOnj6T4AtC."},
+		{"sha256 rounds", "$5$rounds=1000$saltsalt$azOwbpkvuuBKkE82dQPwTsQE8JyT9Fflpr9aKid3aT9"},
+		{"sha512", "$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/"},
+		{"des", "abJnggxhB/yWI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !verify(tt.hash, "password") {
+				t.Errorf("verify() = false for the right password")
+			}
+			if verify(tt.hash, "passwore") {
+				t.Errorf("verify() = true for a wrong password")
+			}
+		})
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "htpasswd")
+	write := func(s string) {
+		if err := ioutil.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("# users\nfoo:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n\nbar:$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n")
+	h, err := LoadHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(username string, want bool) {
+		t.Helper()
+		if got := h.Auth(username, "password"); got != want {
+			t.Errorf("Auth(%q) = %v, want %v", username, got, want)
+		}
+	}
+	check("foo", true)
+	check("bar", true)
+	check("baz", false)
+
+	for _, s := range []string{
+		"foo:password\n",
+		"foo\n",
+		":{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n",
+		"foo:abJnggxhB/yWI\nfoo:abJnggxhB/yWI\n",
+	} {
+		write(s)
+		if err := h.Reload(); err == nil {
+			t.Errorf("Reload() of %q: want error", s)
+		}
+	}
+	check("foo", true) // the users are kept
+
+	h.Watch(0, nil)() // a non-positive interval falls back to the default
+
+	write("baz:abJnggxhB/yWI\n")
+	stop := h.Watch(10*time.Millisecond, func(err error) { t.Error(err) })
+	defer stop()
+	for i := 0; i < 100 && !h.Auth("baz", "password"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	check("baz", true)
+	check("foo", false)
+}
+
+func TestHtpasswdDummy(t *testing.T) {
+	const (
+		sha1   = "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="
+		apr1   = "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/"
+		sha256 = "$5$saltsalt$gOjOtoMpVhru2uyjeJSEc/JaLQWOXMNmlOnj6T4AtC."
+		rounds = "$5$rounds=10000$saltsalt$xxx"
+		sha512 = "$6$saltsalt$qFmFH.bQmmtXzyBY0s9v7Oicd2z4XSIecDzlB5KiA2/jctKu9YterLp8wwnSq.qc.eoxqOmSuNp2xS0ktL3nh/"
+		bcrypt = "$2a$04$9xyw3iDypoJf09iTqmHwYeHWFmgGJ.I2wbYxqxhk39LQf0klsqTPy"
+		costly = "$2y$05$9xyw3iDypoJf09iTqmHwYeHWFmgGJ.I2wbYxqxhk39LQf0klsqTPy"
+	)
+	tests := []struct {
+		hashes []string
+		want   string
+	}{
+		{[]string{sha1, apr1, "abJnggxhB/yWI"}, apr1},
+		{[]string{sha1, rounds, sha256}, rounds},
+		{[]string{sha256, sha512}, sha512},
+		{[]string{sha1, apr1, bcrypt, sha512}, bcrypt},
+		{[]string{bcrypt, costly, sha1}, costly},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		for i, h := range tt.hashes {
+			fmt.Fprintf(&b, "user%d:%s\n", i, h)
+		}
+		c, err := parseHtpasswd(b.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.dummy != tt.want {
+			t.Errorf("%q: got dummy %q, want %q", tt.hashes, c.dummy, tt.want)
+		}
+	}
+}
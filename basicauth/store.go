@@ -0,0 +1,87 @@
+package basicauth
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Store stores the counters of Guard by keys. It must be safe for
+// concurrent use.
+type Store interface {
+	Get(key string) (r Record, ok bool)
+	Put(key string, r Record)
+	Delete(key string)
+}
+
+// DefaultStoreSize is the size of the default MemoryStore of Guard.
+const DefaultStoreSize = 10000
+
+// MemoryStore is a Store in memory that holds a limited number of
+// records, and evicts the least recently used one to make room.
+type MemoryStore struct {
+	size int
+
+	mu    sync.Mutex
+	lru   *list.List // of *storeEntry, the most recently used first
+	items map[string]*list.Element
+}
+
+type storeEntry struct {
+	key    string
+	record Record
+}
+
+// NewMemoryStore returns a MemoryStore that holds at most size records.
+func NewMemoryStore(size int) *MemoryStore {
+	if size <= 0 {
+		panic("basicauth: the size of a MemoryStore must be positive")
+	}
+	return &MemoryStore{
+		size:  size,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Get(key string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return Record{}, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*storeEntry).record, true
+}
+
+func (s *MemoryStore) Put(key string, r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		e.Value.(*storeEntry).record = r
+		s.lru.MoveToFront(e)
+		return
+	}
+	if s.lru.Len() >= s.size {
+		e := s.lru.Back()
+		s.lru.Remove(e)
+		delete(s.items, e.Value.(*storeEntry).key)
+	}
+	s.items[key] = s.lru.PushFront(&storeEntry{key: key, record: r})
+}
+
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.lru.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+// Len returns the number of records in s.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
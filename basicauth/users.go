@@ -0,0 +1,42 @@
+package basicauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+// constantTimeCompare is replaced in tests to count comparisons.
+var constantTimeCompare = subtle.ConstantTimeCompare
+
+// Equal reports whether s equals t in constant time. Unlike
+// subtle.ConstantTimeCompare, it doesn't leak the length of t, as it
+// compares the SHA-256 digests of s and t.
+func Equal(s, t string) bool {
+	x, y := sha256.Sum256([]byte(s)), sha256.Sum256([]byte(t))
+	return constantTimeCompare(x[:], y[:]) == 1
+}
+
+// Users returns a function, which can be used as Config.Auth, that
+// authenticates the users in the map from usernames to passwords. The
+// username and password are compared with every user in constant time, so
+// the time taken doesn't depend on which user, if any, they match. The map
+// is copied and may be modified afterwards.
+func Users(users map[string]string) func(username, password string) bool {
+	type user struct{ name, password [sha256.Size]byte }
+	us := make([]user, 0, len(users))
+	for name, password := range users {
+		us = append(us, user{
+			name:     sha256.Sum256([]byte(name)),
+			password: sha256.Sum256([]byte(password)),
+		})
+	}
+	return func(username, password string) bool {
+		name, pass := sha256.Sum256([]byte(username)), sha256.Sum256([]byte(password))
+		match := 0
+		for i := range us {
+			match |= constantTimeCompare(name[:], us[i].name[:]) &
+				constantTimeCompare(pass[:], us[i].password[:])
+		}
+		return match == 1
+	}
+}
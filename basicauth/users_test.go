@@ -0,0 +1,131 @@
+package basicauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// countCompare counts the calls of constantTimeCompare until the returned
+// function is called, which returns the count.
+func countCompare() func() int {
+	n := 0
+	orig := constantTimeCompare
+	constantTimeCompare = func(x, y []byte) int {
+		n++
+		return orig(x, y)
+	}
+	return func() int {
+		constantTimeCompare = orig
+		return n
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		s, t string
+		want bool
+	}{
+		{"", "", true},
+		{"secret", "secret", true},
+		{"secret", "secreT", false},
+		{"secret", "secret0", false},
+		{"", "secret", false},
+	}
+	for _, tt := range tests {
+		if got := Equal(tt.s, tt.t); got != tt.want {
+			t.Errorf("Equal(%q, %q) = %v, want %v", tt.s, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	users := map[string]string{"foo": "bar", "baz": "qux", "empty": ""}
+	auth := Users(users)
+	users["foo"] = "changed"
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     bool
+	}{
+		{"normal", "foo", "bar", true},
+		{"empty password", "empty", "", true},
+		{"wrong password", "foo", "qux", false},
+		{"password of another user", "baz", "bar", false},
+		{"unknown user", "unknown", "bar", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := countCompare()
+			got := auth(tt.username, tt.password)
+			if n := done(); n != 2*len(users) {
+				t.Errorf("compared %d times, want %d", n, 2*len(users))
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHtpasswdUnknownUser(t *testing.T) {
+	h := &Htpasswd{}
+	c, err := parseHtpasswd([]byte("foo:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.users.Store(c)
+	for _, username := range []string{"foo", "bar"} {
+		done := countCompare()
+		h.Auth(username, "wrong")
+		if n := done(); n != 1 {
+			t.Errorf("Auth(%q): compared %d times, want 1", username, n)
+		}
+	}
+	if h.Auth("bar", "password") {
+		t.Errorf("Auth() of an unknown user with the password of another = true")
+	}
+}
+
+func TestAuthMalformedHeader(t *testing.T) {
+	var calls []string
+	config := &Config{
+		Realm: "Basic Auth",
+		Auth: func(username, password string) bool {
+			calls = append(calls, username+":"+password)
+			return username == "" && password == ""
+		},
+	}
+	handler := Auth(config)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || len(calls) != 0 {
+		t.Errorf("without header: got status = %v, calls = %q, want %v without calls",
+			rec.Code, calls, http.StatusUnauthorized)
+	}
+
+	for _, header := range []string{
+		"Basic",
+		"Basic !!!!",
+		"Basic dXNlcg==", // no colon
+		"Bearer Og==",    // ":" in another scheme
+		"Basic Og== x",
+	} {
+		calls = calls[:0]
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(HeaderAuthorization, header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%q: got status = %v, want %v", header, rec.Code, http.StatusUnauthorized)
+		}
+		if len(calls) != 1 || calls[0] != ":" {
+			t.Errorf("%q: got calls = %q, want one with empty credentials", header, calls)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package bearerauth implements the Bearer authentication scheme of
+// RFC 6750 with JSON Web Tokens (RFC 7519) signed with HS256, RS256 or
+// ES256.
+package bearerauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fanyang01/httpx/internal/httpauth"
+)
+
+const (
+	HeaderAuthorization   = "Authorization"
+	HeaderWWWAuthenticate = "WWW-Authenticate"
+)
+
+type contextKey struct{ int }
+
+// ClaimsContextKey is the context key of the *Claims of the token.
+var ClaimsContextKey = &contextKey{0}
+
+type Config struct {
+	// Keys verify the signatures of tokens.
+	Keys  *KeySet
+	Realm string
+	// Issuer, if not empty, must be the "iss" claim of tokens.
+	Issuer string
+	// Audience, if not empty, must be in the "aud" claim of tokens.
+	Audience string
+	// Scopes must all be in the "scope" claim of tokens, which is a list
+	// of scopes separated by spaces.
+	Scopes []string
+	// ClockSkew is the leeway for the "exp" and "nbf" claims.
+	ClockSkew time.Duration
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+// The error codes of RFC 6750.
+const (
+	errInvalidRequest    = "invalid_request"
+	errInvalidToken      = "invalid_token"
+	errInsufficientScope = "insufficient_scope"
+)
+
+// authError is a failure reported in the WWW-Authenticate header.
+type authError struct {
+	code        string
+	description string
+}
+
+func (e *authError) Error() string {
+	return "bearerauth: " + e.code + ": " + e.description
+}
+
+func (e *authError) status() int {
+	switch e.code {
+	case errInvalidRequest:
+		return http.StatusBadRequest
+	case errInsufficientScope:
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+func invalidToken(description string) *authError {
+	return &authError{code: errInvalidToken, description: description}
+}
+
+func Auth(config *Config) func(http.Handler) http.Handler {
+	if config == nil {
+		panic("bearerauth: the config parameter can't be nil")
+	}
+	if config.Keys == nil {
+		panic("bearerauth: the config has no keys")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			header := req.Header.Get(HeaderAuthorization)
+			defer req.Header.Del(HeaderAuthorization)
+
+			if f := strings.Fields(header); len(f) == 0 || !strings.EqualFold(f[0], "Bearer") {
+				// No error code if the request lacks authentication, e.g.
+				// it uses another scheme.
+				rw.Header().Set(HeaderWWWAuthenticate, config.challenge(nil))
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			claims, err := config.authenticate(req, header)
+			if err != nil {
+				rw.Header().Set(HeaderWWWAuthenticate, config.challenge(err))
+				rw.WriteHeader(err.status())
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), ClaimsContextKey, claims)
+			next.ServeHTTP(rw, req.WithContext(ctx))
+		})
+	}
+}
+
+func (config *Config) authenticate(req *http.Request, header string) (*Claims, *authError) {
+	if len(req.Header.Values(HeaderAuthorization)) > 1 {
+		return nil, &authError{errInvalidRequest, "multiple Authorization headers"}
+	}
+	token, ok := Decode(header)
+	if !ok {
+		return nil, &authError{errInvalidRequest, "malformed Bearer credentials"}
+	}
+	claims, err := parse(token, config.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (config *Config) validate(c *Claims) *authError {
+	t := now()
+	// A token is invalid from its expiration time on (RFC 7519, 4.1.4).
+	if !c.ExpiresAt.IsZero() && !t.Before(c.ExpiresAt.Add(config.ClockSkew)) {
+		return invalidToken("the token has expired")
+	}
+	if !c.NotBefore.IsZero() && t.Add(config.ClockSkew).Before(c.NotBefore) {
+		return invalidToken("the token is not valid yet")
+	}
+	if config.Issuer != "" && c.Issuer != config.Issuer {
+		return invalidToken("the token has a wrong issuer")
+	}
+	if config.Audience != "" && !contains(c.Audience, config.Audience) {
+		return invalidToken("the token is not for this audience")
+	}
+	scopes := strings.Fields(c.Scope)
+	for _, s := range config.Scopes {
+		if !contains(scopes, s) {
+			return &authError{errInsufficientScope, "the token lacks the scope " + s}
+		}
+	}
+	return nil
+}
+
+// challenge returns the WWW-Authenticate header for err, which can be nil.
+func (config *Config) challenge(err *authError) string {
+	s := "Bearer realm=" + httpauth.Quote(config.Realm)
+	if len(config.Scopes) > 0 {
+		s += ", scope=" + httpauth.Quote(strings.Join(config.Scopes, " "))
+	}
+	if err != nil {
+		s += ", error=" + httpauth.Quote(err.code) + ", error_description=" + httpauth.Quote(err.description)
+	}
+	return s
+}
+
+// Decode returns the token in s, the value of an Authorization header of
+// the Bearer scheme.
+func Decode(s string) (token string, ok bool) {
+	ss := strings.Fields(s)
+	if len(ss) != 2 || !strings.EqualFold(ss[0], "Bearer") || !isToken68(ss[1]) {
+		return "", false
+	}
+	return ss[1], true
+}
+
+// isToken68 reports whether s matches the b64token of RFC 6750.
+func isToken68(s string) bool {
+	t := strings.TrimRight(s, "=")
+	if t == "" {
+		return false
+	}
+	for i := 0; i < len(t); i++ {
+		switch c := t[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~', c == '+', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
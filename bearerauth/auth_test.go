@@ -0,0 +1,246 @@
+package bearerauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	hmacKey  = []byte("secret")
+	rsaKey   *rsa.PrivateKey
+	ecdsaKey *ecdsa.PrivateKey
+)
+
+func init() {
+	var err error
+	if rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	if ecdsaKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+func segment(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign returns a token of claims signed with the key of alg.
+func sign(alg, kid string, claims map[string]interface{}) string {
+	h := map[string]interface{}{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	signed := segment(h) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch alg {
+	case HS256:
+		m := hmac.New(sha256.New, hmacKey)
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	case RS256:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	case ES256:
+		r, s, _ := ecdsa.Sign(rand.Reader, ecdsaKey, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func keySet() *KeySet {
+	keys := &KeySet{}
+	keys.AddHMAC("h", hmacKey)
+	keys.AddRSA("r", &rsaKey.PublicKey)
+	keys.AddECDSA("e", &ecdsaKey.PublicKey)
+	return keys
+}
+
+func TestAuth(t *testing.T) {
+	defer func() { now = time.Now }()
+	clock := time.Unix(1e9, 0)
+	now = func() time.Time { return clock }
+
+	config := &Config{
+		Keys:      keySet(),
+		Realm:     "api",
+		Issuer:    "https://issuer.example.com",
+		Audience:  "api",
+		Scopes:    []string{"read"},
+		ClockSkew: time.Minute,
+	}
+	handler := Auth(config)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		c := r.Context().Value(ClaimsContextKey).(*Claims)
+		fmt.Fprint(rw, c.Subject, c.Raw["name"])
+	}))
+	claims := func(kv ...interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   "https://issuer.example.com",
+			"sub":   "foo",
+			"aud":   "api",
+			"exp":   1e9 + 60,
+			"nbf":   1e9,
+			"scope": "write read",
+			"name":  "Foo",
+		}
+		for i := 0; i < len(kv); i += 2 {
+			if kv[i+1] == nil {
+				delete(c, kv[i].(string))
+			} else {
+				c[kv[i].(string)] = kv[i+1]
+			}
+		}
+		return c
+	}
+	valid := sign(RS256, "r", claims())
+	other := sign(RS256, "r", claims("sub", "bar"))
+	tampered := valid[:strings.LastIndexByte(valid, '.')] + other[strings.LastIndexByte(other, '.'):]
+	none := segment(map[string]string{"alg": "none"}) + "." + segment(claims()) + "."
+	hmacRSA := func() string {
+		// An HS256 token with the RSA public key as the secret.
+		h := segment(map[string]string{"alg": HS256}) + "." + segment(claims())
+		m := hmac.New(sha256.New, rsaKey.PublicKey.N.Bytes())
+		m.Write([]byte(h))
+		return h + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+	}()
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantError  string
+	}{
+		{"HS256", "Bearer " + sign(HS256, "h", claims()), 200, ""},
+		{"RS256", "Bearer " + valid, 200, ""},
+		{"ES256", "Bearer " + sign(ES256, "", claims()), 200, ""},
+		{"scheme is case-insensitive", "bearer " + valid, 200, ""},
+		{"audience array", "Bearer " + sign(HS256, "", claims("aud", []string{"x", "api"})), 200, ""},
+		{"expired within skew", "Bearer " + sign(HS256, "", claims("exp", 1e9-30)), 200, ""},
+		{"not before within skew", "Bearer " + sign(HS256, "", claims("nbf", 1e9+30)), 200, ""},
+		{"without exp and nbf", "Bearer " + sign(HS256, "", claims("exp", nil, "nbf", nil)), 200, ""},
+
+		{"without header", "", 401, ""},
+		{"another scheme", "Basic Zm9vOmJhcg==", 401, ""},
+		{"without token", "Bearer", 400, errInvalidRequest},
+		{"malformed token", "Bearer a b", 400, errInvalidRequest},
+		{"invalid characters", "Bearer a,b", 400, errInvalidRequest},
+		{"two segments", "Bearer a.b", 401, errInvalidToken},
+		{"tampered", "Bearer " + tampered, 401, errInvalidToken},
+		{"wrong key ID", "Bearer " + sign(RS256, "e", claims()), 401, errInvalidToken},
+		{"alg none", "Bearer " + none, 401, errInvalidToken},
+		{"HMAC with public key", "Bearer " + hmacRSA, 401, errInvalidToken},
+		{"expired", "Bearer " + sign(HS256, "", claims("exp", 1e9-61)), 401, errInvalidToken},
+		{"expiring now", "Bearer " + sign(HS256, "", claims("exp", 1e9-60)), 401, errInvalidToken},
+		{"not before", "Bearer " + sign(HS256, "", claims("nbf", 1e9+61)), 401, errInvalidToken},
+		{"wrong issuer", "Bearer " + sign(HS256, "", claims("iss", "evil")), 401, errInvalidToken},
+		{"without audience", "Bearer " + sign(HS256, "", claims("aud", nil)), 401, errInvalidToken},
+		{"wrong audience", "Bearer " + sign(HS256, "", claims("aud", []string{"x"})), 401, errInvalidToken},
+		{"malformed exp", "Bearer " + sign(HS256, "", claims("exp", "soon")), 401, errInvalidToken},
+		{"insufficient scope", "Bearer " + sign(HS256, "", claims("scope", "write")), 403, errInsufficientScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderAuthorization, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			challenge := rec.Header().Get(HeaderWWWAuthenticate)
+			switch {
+			case rec.Code == 200:
+				if got, want := rec.Body.String(), "fooFoo"; got != want {
+					t.Errorf("got body = %v, want %v", got, want)
+				}
+			case tt.wantError == "":
+				if want := `Bearer realm="api", scope="read"`; challenge != want {
+					t.Errorf("got header = %v, want %v", challenge, want)
+				}
+			default:
+				prefix := `Bearer realm="api", scope="read", error="` + tt.wantError + `", error_description="`
+				if !strings.HasPrefix(challenge, prefix) {
+					t.Errorf("got header = %v, want prefix %v", challenge, prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	pad := func(i *big.Int) string { return b64(i.FillBytes(make([]byte, 32))) }
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "h", "k": %q},
+		{"kty": "RSA", "kid": "r", "alg": "RS256", "n": %q, "e": "AQAB"},
+		{"kty": "EC", "kid": "e", "use": "sig", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+		{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AA", "y": "AA"}
+	]}`, b64(hmacKey), b64(rsaKey.N.Bytes()), pad(ecdsaKey.X), pad(ecdsaKey.Y))
+
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Len() != 3 {
+		t.Errorf("got %d keys, want 3", keys.Len())
+	}
+	for _, alg := range []string{HS256, RS256, ES256} {
+		for _, kid := range []string{"", alg[:1]} {
+			kid = strings.ToLower(kid)
+			if _, err := parse(sign(alg, kid, map[string]interface{}{}), keys); err != nil {
+				t.Errorf("%s with kid %q: %v", alg, kid, err)
+			}
+		}
+	}
+
+	for _, s := range []string{
+		`{"keys": [{"kty": "oct", "k": ""}]}`,
+		`{"keys": [{"kty": "RSA", "n": "!", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "n": "AQAB", "e": "AQ"}]}`,
+		fmt.Sprintf(`{"keys": [{"kty": "RSA", "n": %q, "e": "AQAB"}]}`,
+			b64(append([]byte{0x80}, make([]byte, 127)...))),
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		`{"keys": {}}`,
+	} {
+		if _, err := ParseJWKS([]byte(s)); err == nil {
+			t.Errorf("ParseJWKS(%s): want error", s)
+		}
+	}
+}
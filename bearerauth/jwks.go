@@ -0,0 +1,194 @@
+package bearerauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// The supported signature algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// KeySet is a set of keys verifying tokens. A token with a "kid" header is
+// verified with the key of the ID only, and a token without it is
+// verified with each key. A key verifies tokens of the algorithm of its
+// type only, so that a public key can't be used as an HMAC secret.
+type KeySet struct {
+	keys []key
+}
+
+type key struct {
+	id  string
+	alg string
+	key interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// AddHMAC adds a secret of HS256 with the key ID id, which can be empty.
+func (s *KeySet) AddHMAC(id string, secret []byte) {
+	s.keys = append(s.keys, key{id: id, alg: HS256, key: secret})
+}
+
+// MinRSABits is the minimum size of RSA keys.
+const MinRSABits = 2048
+
+// AddRSA adds a public key of RS256 with the key ID id, which can be
+// empty. The key must have at least MinRSABits bits.
+func (s *KeySet) AddRSA(id string, pub *rsa.PublicKey) {
+	if pub.N.BitLen() < MinRSABits {
+		panic(fmt.Sprintf("bearerauth: an RS256 key must have at least %d bits", MinRSABits))
+	}
+	s.keys = append(s.keys, key{id: id, alg: RS256, key: pub})
+}
+
+// AddECDSA adds a public key of ES256 with the key ID id, which can be
+// empty. The curve of the key must be P-256.
+func (s *KeySet) AddECDSA(id string, pub *ecdsa.PublicKey) {
+	if pub.Curve != elliptic.P256() {
+		panic("bearerauth: the curve of an ES256 key must be P-256")
+	}
+	s.keys = append(s.keys, key{id: id, alg: ES256, key: pub})
+}
+
+// Len returns the number of keys in s.
+func (s *KeySet) Len() int {
+	return len(s.keys)
+}
+
+func (s *KeySet) verify(alg, kid string, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	for _, k := range s.keys {
+		if k.alg != alg || kid != "" && k.id != kid {
+			continue
+		}
+		switch pub := k.key.(type) {
+		case []byte:
+			m := hmac.New(sha256.New, pub)
+			m.Write(signed)
+			if hmac.Equal(m.Sum(nil), sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if len(sig) != 64 {
+				continue
+			}
+			r, ss := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(pub, digest[:], r, ss) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwk is a JSON Web Key of RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS loads a JSON Web Key Set from the file at path.
+func LoadJWKS(path string) (*KeySet, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("bearerauth: %v", err)
+	}
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parses a JSON Web Key Set. Keys of the "oct", "RSA" and "EC"
+// (P-256) types are added; the others, and keys not used for signatures,
+// are ignored.
+func ParseJWKS(b []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("bearerauth: %v", err)
+	}
+	s := &KeySet{}
+	for i, k := range set.Keys {
+		if err := s.add(k); err != nil {
+			return nil, fmt.Errorf("bearerauth: key %d: %v", i, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *KeySet) add(k jwk) error {
+	if k.Use != "" && k.Use != "sig" {
+		return nil
+	}
+	var alg string
+	switch {
+	case k.Kty == "oct":
+		alg = HS256
+	case k.Kty == "RSA":
+		alg = RS256
+	case k.Kty == "EC" && k.Crv == "P-256":
+		alg = ES256
+	default:
+		return nil
+	}
+	if k.Alg != "" && k.Alg != alg {
+		return nil
+	}
+
+	switch alg {
+	case HS256:
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return fmt.Errorf("invalid secret")
+		}
+		s.AddHMAC(k.Kid, secret)
+	case RS256:
+		n, err1 := decodeInt(k.N)
+		e, err2 := decodeInt(k.E)
+		if err1 != nil || err2 != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return fmt.Errorf("invalid RSA key")
+		}
+		if n.BitLen() < MinRSABits {
+			return fmt.Errorf("RSA key of %d bits is smaller than %d bits", n.BitLen(), MinRSABits)
+		}
+		s.AddRSA(k.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())})
+	case ES256:
+		x, err1 := decodeInt(k.X)
+		y, err2 := decodeInt(k.Y)
+		if err1 != nil || err2 != nil || !elliptic.P256().IsOnCurve(x, y) {
+			return fmt.Errorf("invalid EC key")
+		}
+		s.AddECDSA(k.Kid, &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+	}
+	return nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
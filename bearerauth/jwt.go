@@ -0,0 +1,123 @@
+package bearerauth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+)
+
+// Claims are the claims of a token. Registered claims that are absent are
+// zero values.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	Scope     string
+	// Raw holds all the claims, including the ones above, as decoded by
+	// encoding/json with numbers as json.Number.
+	Raw map[string]interface{}
+}
+
+type header struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Crit []string `json:"crit"`
+}
+
+// parse verifies the signature of token with keys and returns its claims.
+// The claims are not validated.
+func parse(token string, keys *KeySet) (*Claims, *authError) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+	var h header
+	if !decodeSegment(parts[0], &h) {
+		return nil, invalidToken("malformed token header")
+	}
+	if len(h.Crit) > 0 {
+		return nil, invalidToken("unsupported critical header parameters")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed token signature")
+	}
+	if !keys.verify(h.Alg, h.Kid, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, invalidToken("invalid token signature")
+	}
+
+	c := &Claims{}
+	if !decodeSegment(parts[1], &c.Raw) || c.Raw == nil {
+		return nil, invalidToken("malformed token claims")
+	}
+	ok := stringClaim(c.Raw, "iss", &c.Issuer) &&
+		stringClaim(c.Raw, "sub", &c.Subject) &&
+		stringClaim(c.Raw, "jti", &c.ID) &&
+		stringClaim(c.Raw, "scope", &c.Scope) &&
+		timeClaim(c.Raw, "exp", &c.ExpiresAt) &&
+		timeClaim(c.Raw, "nbf", &c.NotBefore) &&
+		timeClaim(c.Raw, "iat", &c.IssuedAt)
+	switch aud := c.Raw["aud"].(type) {
+	case nil:
+	case string:
+		c.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			s, isString := a.(string)
+			ok = ok && isString
+			c.Audience = append(c.Audience, s)
+		}
+	default:
+		ok = false
+	}
+	if !ok {
+		return nil, invalidToken("malformed token claims")
+	}
+	return c, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON value into v.
+func decodeSegment(s string, v interface{}) bool {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return false
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v) == nil && !d.More()
+}
+
+func stringClaim(raw map[string]interface{}, name string, p *string) bool {
+	v, ok := raw[name]
+	if !ok {
+		return true
+	}
+	*p, ok = v.(string)
+	return ok
+}
+
+// timeClaim decodes a NumericDate, the seconds since the epoch.
+func timeClaim(raw map[string]interface{}, name string, p *time.Time) bool {
+	v, ok := raw[name]
+	if !ok {
+		return true
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return false
+	}
+	f, err := n.Float64()
+	if err != nil || math.IsInf(f, 0) || math.Abs(f) > 1<<62/1e9 {
+		return false
+	}
+	sec, frac := math.Modf(f)
+	*p = time.Unix(int64(sec), int64(frac*1e9))
+	return true
+}
@@ -0,0 +1,219 @@
+// Package digestauth implements HTTP Digest access authentication as
+// defined by RFC 7616, with the SHA-256 and MD5 algorithms and the "auth"
+// quality of protection.
+package digestauth
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fanyang01/httpx/internal/httpauth"
+)
+
+const (
+	HeaderProxyAuthorization      = "Proxy-Authorization"
+	HeaderProxyAuthenticate       = "Proxy-Authenticate"
+	HeaderProxyAuthenticationInfo = "Proxy-Authentication-Info"
+	HeaderAuthorization           = "Authorization"
+	HeaderWWWAuthenticate         = "WWW-Authenticate"
+	HeaderAuthenticationInfo      = "Authentication-Info"
+)
+
+// The supported algorithms.
+const (
+	SHA256 = "SHA-256"
+	MD5    = "MD5"
+)
+
+// DefaultNonceTTL is the default lifetime of nonces.
+const DefaultNonceTTL = 5 * time.Minute
+
+type contextKey struct{ int }
+
+var (
+	UserContextKey      = &contextKey{0}
+	ProxyUserContextKey = &contextKey{1}
+)
+
+type Config struct {
+	// Password returns the password of username, or false if there is no
+	// such user.
+	Password func(username string) (password string, ok bool)
+	Realm    string
+	// Algorithms are offered to clients in order of preference. The
+	// default is SHA256 and MD5, as clients unaware of SHA-256 pick MD5.
+	Algorithms []string
+	// NonceTTL is how long a nonce can be used. Requests with an expired
+	// nonce are challenged with stale=true, so clients retry with a new
+	// nonce without asking users again. The default is DefaultNonceTTL.
+	NonceTTL time.Duration
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+type digest struct {
+	config     *Config
+	algorithms []string
+	nonces     *nonces
+	opaque     string
+
+	chdr, shdr, ihdr string
+	code             int
+	ck               *contextKey
+}
+
+func auth(config *Config, chdr, shdr, ihdr string, code int, ck *contextKey) func(http.Handler) http.Handler {
+	if config == nil {
+		panic("digestauth: the config parameter can't be nil")
+	}
+	d := &digest{
+		config:     config,
+		algorithms: config.Algorithms,
+		nonces:     newNonces(config.NonceTTL),
+		opaque:     random(16),
+		chdr:       chdr,
+		shdr:       shdr,
+		ihdr:       ihdr,
+		code:       code,
+		ck:         ck,
+	}
+	if len(d.algorithms) == 0 {
+		d.algorithms = []string{SHA256, MD5}
+	}
+	for _, a := range d.algorithms {
+		if newHash(a) == nil {
+			panic(fmt.Sprintf("digestauth: unsupported algorithm %q", a))
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			header := req.Header.Get(chdr)
+			defer req.Header.Del(chdr)
+
+			c, ok := parseCredentials(header)
+			stale := false
+			if ok {
+				ok, stale = d.check(req, c)
+			}
+			if !ok {
+				d.challenge(rw, stale)
+				return
+			}
+
+			rw.Header().Set(ihdr, d.info(c))
+			ctx := context.WithValue(req.Context(), ck, c.username)
+			next.ServeHTTP(rw, req.WithContext(ctx))
+		})
+	}
+}
+
+func AuthProxy(config *Config) func(http.Handler) http.Handler {
+	return auth(config, HeaderProxyAuthorization, HeaderProxyAuthenticate,
+		HeaderProxyAuthenticationInfo, http.StatusProxyAuthRequired, ProxyUserContextKey)
+}
+
+func Auth(config *Config) func(http.Handler) http.Handler {
+	return auth(config, HeaderAuthorization, HeaderWWWAuthenticate,
+		HeaderAuthenticationInfo, http.StatusUnauthorized, UserContextKey)
+}
+
+// check reports whether the credentials c are valid for req. If the digest
+// is right but the nonce has expired, stale is true.
+func (d *digest) check(req *http.Request, c *credentials) (ok, stale bool) {
+	if c.realm != d.config.Realm || c.qop != "auth" || c.uri != req.RequestURI ||
+		c.opaque != "" && c.opaque != d.opaque || !d.offers(c.algorithm) {
+		return false, false
+	}
+	nc, err := strconv.ParseUint(c.nc, 16, 32)
+	if len(c.nc) != 8 || err != nil || nc == 0 {
+		return false, false
+	}
+	issued, ok := d.nonces.verify(c.nonce)
+	if !ok {
+		return false, false
+	}
+
+	// The digest is computed for unknown users too, so that they take as
+	// long as wrong passwords.
+	password, known := d.config.Password(c.username)
+	h := newHash(c.algorithm)
+	c.ha1 = hexHash(h, c.username, c.realm, password)
+	want := hexHash(h, c.ha1, c.nonce, c.nc, c.cnonce, c.qop, hexHash(h, req.Method, c.uri))
+	if subtle.ConstantTimeCompare([]byte(want), []byte(c.response)) != 1 || !known {
+		return false, false
+	}
+	if now().Sub(issued) > d.nonces.ttl {
+		return false, true
+	}
+	// A nonce count that isn't greater than the last one is a replay.
+	return d.nonces.use(c.nonce, issued, nc), false
+}
+
+func (d *digest) offers(algorithm string) bool {
+	for _, a := range d.algorithms {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// challenge writes a challenge for each algorithm, with the same nonce.
+func (d *digest) challenge(rw http.ResponseWriter, stale bool) {
+	nonce := d.nonces.new()
+	for _, a := range d.algorithms {
+		s := fmt.Sprintf(`Digest realm=%s, qop="auth", algorithm=%s, nonce="%s", opaque="%s"`,
+			httpauth.Quote(d.config.Realm), a, nonce, d.opaque)
+		if stale {
+			s += ", stale=true"
+		}
+		rw.Header().Add(d.shdr, s)
+	}
+	rw.WriteHeader(d.code)
+}
+
+// info returns the Authentication-Info for the credentials c checked by
+// check, which lets the client authenticate the server.
+func (d *digest) info(c *credentials) string {
+	h := newHash(c.algorithm)
+	rspauth := hexHash(h, c.ha1, c.nonce, c.nc, c.cnonce, c.qop, hexHash(h, "", c.uri))
+	return fmt.Sprintf(`rspauth="%s", qop=auth, nc=%s, cnonce=%s`, rspauth, c.nc, httpauth.Quote(c.cnonce))
+}
+
+func newHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case SHA256:
+		return sha256.New
+	case MD5:
+		return md5.New
+	}
+	return nil
+}
+
+// hexHash returns the hex-encoded digest of ss joined by colons.
+func hexHash(h func() hash.Hash, ss ...string) string {
+	hh := h()
+	hh.Write([]byte(strings.Join(ss, ":")))
+	return hex.EncodeToString(hh.Sum(nil))
+}
+
+// random returns n random bytes encoded in base64.
+func random(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("digestauth: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
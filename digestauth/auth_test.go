@@ -0,0 +1,229 @@
+package digestauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/httpx/internal/httpauth"
+)
+
+func TestResponse(t *testing.T) {
+	// The examples in RFC 7616, section 3.9.1.
+	const (
+		username = "Mufasa"
+		realm    = "http-auth@example.org"
+		password = "Circle of Life"
+		nonce    = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+		cnonce   = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+		uri      = "/dir/index.html"
+	)
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{SHA256, "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+		{MD5, "8ca523f5e9506fed4657c9700eebdbec"},
+	}
+	for _, tt := range tests {
+		h := newHash(tt.algorithm)
+		ha1 := hexHash(h, username, realm, password)
+		got := hexHash(h, ha1, nonce, "00000001", cnonce, "auth", hexHash(h, "GET", uri))
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.algorithm, got, tt.want)
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		s      string
+		want   map[string]string
+		wantOk bool
+	}{
+		{``, map[string]string{}, true},
+		{`a=1, B="x, \"y\"" ,c=`, map[string]string{"a": "1", "b": `x, "y"`, "c": ""}, true},
+		{`a="1`, nil, false},
+		{`a=1, a=2`, nil, false},
+		{`a="1" b=2`, nil, false},
+		{`=1`, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseParams(tt.s)
+		if ok != tt.wantOk || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseParams(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+// client computes the credentials for a challenge like a user agent.
+type client struct {
+	username, password string
+	params             map[string]string
+	nc                 int
+}
+
+func (c *client) challenged(t *testing.T, challenge string) {
+	t.Helper()
+	params, ok := parseParams(strings.TrimPrefix(challenge, "Digest "))
+	if !ok {
+		t.Fatalf("bad challenge %q", challenge)
+	}
+	c.params, c.nc = params, 0
+}
+
+func (c *client) authorization(method, uri string) string {
+	c.nc++
+	p := c.params
+	h := newHash(p["algorithm"])
+	nc := fmt.Sprintf("%08x", c.nc)
+	ha1 := hexHash(h, c.username, p["realm"], c.password)
+	response := hexHash(h, ha1, p["nonce"], nc, "cnonce", "auth", hexHash(h, method, uri))
+	return fmt.Sprintf(`Digest username=%s, realm=%s, uri="%s", algorithm=%s, nonce="%s", `+
+		`nc=%s, cnonce="cnonce", qop=auth, response="%s", opaque="%s"`,
+		httpauth.Quote(c.username), httpauth.Quote(p["realm"]), uri, p["algorithm"], p["nonce"], nc, response, p["opaque"])
+}
+
+func TestAuth(t *testing.T) {
+	defer func() { now = time.Now }()
+	var clock time.Time
+	now = func() time.Time { return clock }
+	clock = time.Unix(1e9, 0)
+
+	config := &Config{
+		Realm: `Digest "Auth"`,
+		Password: func(username string) (string, bool) {
+			return "bar", username == "foo" || username == "föö"
+		},
+		NonceTTL: time.Minute,
+	}
+	handler := Auth(config)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, r.Context().Value(UserContextKey))
+	}))
+	do := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/dir/index.html?q=1", nil)
+		if header != "" {
+			req.Header.Set(HeaderAuthorization, header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("")
+	challenges := rec.Header().Values(HeaderWWWAuthenticate)
+	if rec.Code != 401 || len(challenges) != 2 {
+		t.Fatalf("without header: got %v %q, want 401 with 2 challenges", rec.Code, challenges)
+	}
+	for i, algorithm := range []string{SHA256, MD5} {
+		// The challenges share a nonce, whose counts are used up by the
+		// previous algorithm.
+		c := &client{username: "foo", password: "bar"}
+		c.challenged(t, do("").Header().Values(HeaderWWWAuthenticate)[i])
+		if got := c.params["algorithm"]; got != algorithm {
+			t.Errorf("challenge %d: algorithm = %v, want %v", i, got, algorithm)
+		}
+		if got := c.params["realm"]; got != config.Realm {
+			t.Errorf("challenge %d: realm = %v, want %v", i, got, config.Realm)
+		}
+
+		rec := do(c.authorization("GET", "/dir/index.html?q=1"))
+		if rec.Code != 200 || rec.Body.String() != "foo" {
+			t.Fatalf("%s: got %v %q, want 200", algorithm, rec.Code, rec.Body)
+		}
+		info, _ := parseParams(rec.Header().Get(HeaderAuthenticationInfo))
+		h := newHash(algorithm)
+		ha1 := hexHash(h, "foo", config.Realm, "bar")
+		if want := hexHash(h, ha1, c.params["nonce"], "00000001", "cnonce", "auth", hexHash(h, "", "/dir/index.html?q=1")); info["rspauth"] != want {
+			t.Errorf("%s: rspauth = %v, want %v", algorithm, info["rspauth"], want)
+		}
+
+		// The nonce can be used again with a greater nonce count only.
+		header := c.authorization("GET", "/dir/index.html?q=1")
+		if rec := do(header); rec.Code != 200 {
+			t.Errorf("%s: nc=2: got %v, want 200", algorithm, rec.Code)
+		}
+		if rec := do(header); rec.Code != 401 {
+			t.Errorf("%s: replay: got %v, want 401", algorithm, rec.Code)
+		}
+	}
+
+	c := &client{username: "foo", password: "bar"}
+	c.challenged(t, challenges[0])
+	for _, tt := range []struct {
+		name   string
+		header string
+	}{
+		{"wrong password", (&client{"foo", "baz", c.params, 0}).authorization("GET", "/dir/index.html?q=1")},
+		{"unknown user", (&client{"baz", "bar", c.params, 0}).authorization("GET", "/dir/index.html?q=1")},
+		{"wrong uri", c.authorization("GET", "/dir/index.html")},
+		{"wrong method", c.authorization("POST", "/dir/index.html?q=1")},
+		{"forged nonce", strings.Replace(c.authorization("GET", "/dir/index.html?q=1"), `nonce="`, `nonce="A`, 1)},
+		{"basic", "Basic Zm9vOmJhcg=="},
+	} {
+		rec := do(tt.header)
+		if rec.Code != 401 || strings.Contains(rec.Header().Get(HeaderWWWAuthenticate), "stale") {
+			t.Errorf("%s: got %v %q, want 401 without stale", tt.name, rec.Code, rec.Header().Get(HeaderWWWAuthenticate))
+		}
+	}
+
+	ext := &client{username: "föö", password: "bar", params: c.params}
+	header := strings.Replace(ext.authorization("GET", "/dir/index.html?q=1"),
+		`username="föö"`, `username*=UTF-8''f%C3%B6%C3%B6`, 1)
+	if rec := do(header); rec.Code != 200 || rec.Body.String() != "föö" {
+		t.Errorf("username*: got %v %q, want 200", rec.Code, rec.Body)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	wrong := &client{username: "foo", password: "baz", params: c.params}
+	if rec := do(wrong.authorization("GET", "/dir/index.html?q=1")); strings.Contains(rec.Header().Get(HeaderWWWAuthenticate), "stale") {
+		t.Errorf("expired nonce with wrong password: got stale challenge")
+	}
+	rec = do(c.authorization("GET", "/dir/index.html?q=1"))
+	if rec.Code != 401 || !strings.HasSuffix(rec.Header().Get(HeaderWWWAuthenticate), ", stale=true") {
+		t.Fatalf("expired nonce: got %v %q, want 401 with stale=true", rec.Code, rec.Header().Get(HeaderWWWAuthenticate))
+	}
+	c.challenged(t, rec.Header().Get(HeaderWWWAuthenticate))
+	if rec := do(c.authorization("GET", "/dir/index.html?q=1")); rec.Code != 200 {
+		t.Errorf("new nonce: got %v, want 200", rec.Code)
+	}
+}
+
+func TestAuthProxy(t *testing.T) {
+	config := &Config{
+		Realm:      "HTTP Proxy",
+		Algorithms: []string{MD5},
+		Password: func(username string) (string, bool) {
+			return "bar", username == "foo"
+		},
+	}
+	handler := AuthProxy(config)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, r.Context().Value(ProxyUserContextKey))
+	}))
+	do := func(name, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		if name != "" {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("", "")
+	if rec.Code != 407 || len(rec.Header().Values(HeaderProxyAuthenticate)) != 1 {
+		t.Fatalf("without header: got %v %q, want 407 with 1 challenge", rec.Code, rec.Header())
+	}
+	c := &client{username: "foo", password: "bar"}
+	c.challenged(t, rec.Header().Get(HeaderProxyAuthenticate))
+	if rec := do(HeaderAuthorization, c.authorization("GET", "http://example.com/")); rec.Code != 407 {
+		t.Errorf("authorization header: got %v, want 407", rec.Code)
+	}
+	rec = do(HeaderProxyAuthorization, c.authorization("GET", "http://example.com/"))
+	if rec.Code != 200 || rec.Body.String() != "foo" || rec.Header().Get(HeaderProxyAuthenticationInfo) == "" {
+		t.Errorf("normal: got %v %q %q, want 200", rec.Code, rec.Body, rec.Header())
+	}
+}
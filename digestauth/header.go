@@ -0,0 +1,119 @@
+package digestauth
+
+import (
+	"net/url"
+	"strings"
+)
+
+// credentials are the parameters of the Authorization header.
+type credentials struct {
+	username  string
+	realm     string
+	nonce     string
+	uri       string
+	response  string
+	algorithm string
+	cnonce    string
+	opaque    string
+	qop       string
+	nc        string
+
+	ha1 string // set by digest.check
+}
+
+// parseCredentials parses the credentials of the Digest scheme in s.
+// Hashed usernames (userhash=true) are not supported.
+func parseCredentials(s string) (*credentials, bool) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i < 0 || !strings.EqualFold(s[:i], "Digest") {
+		return nil, false
+	}
+	params, ok := parseParams(s[i+1:])
+	if !ok {
+		return nil, false
+	}
+	c := &credentials{
+		username:  params["username"],
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		uri:       params["uri"],
+		response:  params["response"],
+		algorithm: params["algorithm"],
+		cnonce:    params["cnonce"],
+		opaque:    params["opaque"],
+		qop:       params["qop"],
+		nc:        params["nc"],
+	}
+	if ext, ok := params["username*"]; ok {
+		// RFC 5987 encoding: charset'language'value-chars
+		parts := strings.SplitN(ext, "'", 3)
+		if _, ok := params["username"]; ok || len(parts) != 3 || !strings.EqualFold(parts[0], "UTF-8") {
+			return nil, false
+		}
+		u, err := url.PathUnescape(parts[2])
+		if err != nil {
+			return nil, false
+		}
+		c.username = u
+	}
+	if c.algorithm == "" {
+		c.algorithm = MD5
+	}
+	if params["userhash"] == "true" || c.username == "" || c.nonce == "" ||
+		c.response == "" || c.cnonce == "" {
+		return nil, false
+	}
+	return c, true
+}
+
+// parseParams parses a comma-separated list of name=value pairs, where
+// values are tokens or quoted strings. Names are case-insensitive.
+func parseParams(s string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params, true
+		}
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, false
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			j := 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+					if j == len(s) {
+						return nil, false
+					}
+				}
+				b.WriteByte(s[j])
+			}
+			if j == len(s) {
+				return nil, false
+			}
+			value, s = b.String(), s[j+1:]
+		} else {
+			j := strings.IndexByte(s, ',')
+			if j < 0 {
+				j = len(s)
+			}
+			value, s = strings.TrimSpace(s[:j]), s[j:]
+		}
+		s = strings.TrimLeft(s, " \t")
+		if s != "" && s[0] != ',' {
+			return nil, false
+		}
+		if _, ok := params[name]; ok {
+			return nil, false
+		}
+		params[name] = value
+	}
+}
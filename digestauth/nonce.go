@@ -0,0 +1,97 @@
+package digestauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// nonces issues nonces and records the last nonce count of each nonce in
+// use. A nonce is the time it's issued and random bytes, signed with a
+// secret key, so nonces needn't be recorded until they are used.
+type nonces struct {
+	key []byte
+	ttl time.Duration
+
+	mu     sync.Mutex
+	counts map[string]count
+	sweep  time.Time // when to delete expired counts
+}
+
+type count struct {
+	nc      uint64
+	expires time.Time
+}
+
+const (
+	nonceTime   = 8
+	nonceRandom = 8
+	nonceMAC    = 16
+	nonceSize   = nonceTime + nonceRandom + nonceMAC
+)
+
+func newNonces(ttl time.Duration) *nonces {
+	if ttl <= 0 {
+		ttl = DefaultNonceTTL
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("digestauth: %v", err))
+	}
+	return &nonces{key: key, ttl: ttl, counts: make(map[string]count)}
+}
+
+func (n *nonces) mac(b []byte) []byte {
+	m := hmac.New(sha256.New, n.key)
+	m.Write(b)
+	return m.Sum(nil)[:nonceMAC]
+}
+
+func (n *nonces) new() string {
+	var b [nonceSize]byte
+	binary.BigEndian.PutUint64(b[:nonceTime], uint64(now().UnixNano()))
+	if _, err := rand.Read(b[nonceTime : nonceTime+nonceRandom]); err != nil {
+		panic(fmt.Sprintf("digestauth: %v", err))
+	}
+	copy(b[nonceTime+nonceRandom:], n.mac(b[:nonceTime+nonceRandom]))
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// verify reports whether nonce was issued by n, and returns the time it
+// was issued.
+func (n *nonces) verify(nonce string) (issued time.Time, ok bool) {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != nonceSize {
+		return time.Time{}, false
+	}
+	if !hmac.Equal(b[nonceTime+nonceRandom:], n.mac(b[:nonceTime+nonceRandom])) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b[:nonceTime]))), true
+}
+
+// use records the nonce count nc of nonce, and reports whether it's
+// greater than the last one recorded.
+func (n *nonces) use(nonce string, issued time.Time, nc uint64) bool {
+	t := now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if t.After(n.sweep) {
+		for k, c := range n.counts {
+			if t.After(c.expires) {
+				delete(n.counts, k)
+			}
+		}
+		n.sweep = t.Add(n.ttl)
+	}
+	if c, ok := n.counts[nonce]; ok && nc <= c.nc {
+		return false
+	}
+	n.counts[nonce] = count{nc: nc, expires: issued.Add(n.ttl)}
+	return true
+}
@@ -0,0 +1,5 @@
+module github.com/fanyang01/httpx
+
+go 1.21
+
+require golang.org/x/crypto v0.9.0
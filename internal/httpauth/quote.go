@@ -0,0 +1,12 @@
+// Package httpauth provides helpers for the headers of HTTP authentication,
+// shared by the authentication packages.
+package httpauth
+
+import "strings"
+
+var quoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Quote returns s as a quoted-string of RFC 7230.
+func Quote(s string) string {
+	return `"` + quoter.Replace(s) + `"`
+}
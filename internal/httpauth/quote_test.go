@@ -0,0 +1,16 @@
+package httpauth
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct{ s, want string }{
+		{"", `""`},
+		{"realm", `"realm"`},
+		{`a "b" \c`, `"a \"b\" \\c"`},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.s); got != tt.want {
+			t.Errorf("Quote(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
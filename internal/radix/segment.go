@@ -0,0 +1,380 @@
+package radix
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// segment is a compiled parameter segment such as ":id", ":id<int>" or
+// ":name.:ext". A segment is a sequence of static text and parameters, and
+// two parameters can't be adjacent.
+type segment struct {
+	parts []part
+	// shape is the segment without parameter names. Two parameter
+	// segments with the same shape at the same position are ambiguous.
+	shape string
+	// static and checks are the length of static text and the number of
+	// constraints, which determine the priority of the segment.
+	static, checks int
+}
+
+// part is either static text or a parameter.
+type part struct {
+	text  string
+	name  string
+	check func(string) bool
+}
+
+func (p *part) param() bool { return p.text == "" }
+
+var constraints = struct {
+	sync.RWMutex
+	m map[string]func(string) bool
+}{
+	m: map[string]func(string) bool{
+		"int":   isInt,
+		"uint":  isUint,
+		"alpha": isAlpha,
+		"alnum": isAlnum,
+		"hex":   isHex,
+		"uuid":  isUUID,
+	},
+}
+
+// RegisterConstraint registers a named constraint that can be used in
+// patterns as ":name<constraint>". It panics if the name is already used.
+// Constraints are resolved when patterns are added, so they must be
+// registered before patterns that use them, or adding them panics.
+func RegisterConstraint(name string, f func(string) bool) {
+	constraints.Lock()
+	defer constraints.Unlock()
+	if _, ok := constraints.m[name]; ok {
+		panic(fmt.Errorf("radix: constraint %q is already registered", name))
+	}
+	constraints.m[name] = f
+}
+
+// constraint returns the constraint s, which is either the name of a
+// registered constraint or a regular expression. An unknown name panics
+// instead of matching only itself, which is likely a typo or a constraint
+// registered too late; a regular expression that is a name can be written
+// in parentheses.
+func constraint(s string) func(string) bool {
+	constraints.RLock()
+	f, ok := constraints.m[s]
+	constraints.RUnlock()
+	if ok {
+		return f
+	}
+	if isName(s) {
+		panic(fmt.Errorf("radix: unknown constraint <%s>: register it before adding patterns, or write <(%s)> to match it literally", s, s))
+	}
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	if err != nil {
+		panic(fmt.Errorf("radix: invalid constraint <%s>: %v", s, err))
+	}
+	return re.MatchString
+}
+
+// isParam reports whether the segment s contains parameters or escaped
+// colons, which are compiled by compileSegment. A segment starting with '*'
+// is a capture-all segment instead.
+func isParam(s string) bool {
+	return firstbyte(s) != '*' && strings.IndexByte(s, ':') >= 0
+}
+
+// isName reports whether s is a valid name of a parameter or constraint.
+func isName(s string) bool {
+	if c := firstbyte(s); c != '_' && !isLetter(c) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !IsNameByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsNameByte reports whether c can appear in the name of a parameter.
+func IsNameByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c|0x20 && c|0x20 <= 'z'
+}
+
+// checkConstraints panics if a constraint in path contains '/', which
+// would otherwise be split apart with the segment. A parameter never
+// matches across segments, so a constraint doesn't need '/'.
+func checkConstraints(path string) {
+	for i := 0; i < len(path); i++ {
+		if path[i] != ':' {
+			continue
+		}
+		if strings.HasPrefix(path[i:], "::") {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(path) && IsNameByte(path[j]) {
+			j++
+		}
+		if !strings.HasPrefix(path[j:], "<") {
+			continue
+		}
+		end := closing(path[j:])
+		if end < 0 {
+			return // reported by compileSegment
+		}
+		if c := path[j+1 : j+end]; strings.IndexByte(c, '/') >= 0 {
+			panic(fmt.Errorf("radix: invalid pattern %q: constraint <%s> contains '/'", path, c))
+		}
+		i = j + end
+	}
+}
+
+// compileSegment compiles a segment containing parameters. The name of a
+// parameter starts with a letter or an underscore, followed by letters,
+// digits and underscores, and may be followed by a constraint in angle
+// brackets. "::" stands for a literal ':', so a segment such as "12::30"
+// matches "12:30" only.
+func compileSegment(s string) *segment {
+	var (
+		seg   segment
+		shape bytes.Buffer
+		text  bytes.Buffer
+		rest  = s
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			seg.parts = append(seg.parts, part{text: text.String()})
+			seg.static += text.Len()
+			text.Reset()
+		}
+	}
+	for rest != "" {
+		i := strings.IndexByte(rest, ':')
+		if i < 0 {
+			i = len(rest)
+		}
+		if i > 0 {
+			text.WriteString(rest[:i])
+			shape.WriteString(rest[:i])
+			rest = rest[i:]
+			continue
+		}
+		if strings.HasPrefix(rest, "::") {
+			text.WriteByte(':')
+			shape.WriteString("::")
+			rest = rest[2:]
+			continue
+		}
+
+		flush()
+		if n := len(seg.parts); n > 0 && seg.parts[n-1].param() {
+			panic(fmt.Errorf("radix: invalid segment %q: adjacent parameters", s))
+		}
+		rest = rest[1:]
+		if c := firstbyte(rest); c != '_' && !isLetter(c) {
+			panic(fmt.Errorf("radix: invalid segment %q: a parameter name must start with a letter or '_', and a literal ':' is written as \"::\"", s))
+		}
+		for i < len(rest) && IsNameByte(rest[i]) {
+			i++
+		}
+		p := part{name: rest[:i]}
+		rest = rest[i:]
+		shape.WriteByte(':')
+		if strings.HasPrefix(rest, "<") {
+			end := closing(rest)
+			if end < 0 {
+				panic(fmt.Errorf("radix: invalid segment %q: unterminated constraint", s))
+			}
+			p.check = constraint(rest[1:end])
+			seg.checks++
+			shape.WriteString(rest[:end+1])
+			rest = rest[end+1:]
+		}
+		seg.parts = append(seg.parts, p)
+	}
+	flush()
+	seg.shape = shape.String()
+	return &seg
+}
+
+// Expand builds a path from pattern by replacing every parameter with the
+// result of f, which is called with the name of the parameter and whether
+// it's a capture-all parameter.
+func Expand(pattern string, f func(name string, all bool) (string, error)) (string, error) {
+	ss := strings.Split(pattern, "/")
+	for i, s := range ss {
+		switch {
+		case firstbyte(s) == '*':
+			v, err := f(s[1:], true)
+			if err != nil {
+				return "", err
+			}
+			ss[i] = v
+		case isParam(s):
+			var buf bytes.Buffer
+			for _, p := range compileSegment(s).parts {
+				if !p.param() {
+					buf.WriteString(p.text)
+					continue
+				}
+				v, err := f(p.name, false)
+				if err != nil {
+					return "", err
+				}
+				buf.WriteString(v)
+			}
+			ss[i] = buf.String()
+		}
+	}
+	return strings.Join(ss, "/"), nil
+}
+
+// closing returns the index of the '>' closing the '<' at the start of s,
+// or -1 if there is no such byte.
+func closing(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<':
+			depth++
+		case '>':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// match matches s against the segment and captures the parameters. A
+// parameter that makes up the whole segment may be empty, while parameters
+// surrounded by static text match at least one byte, as many as possible.
+func (seg *segment) match(t *Tree, s string, ps *Params) bool {
+	if len(seg.parts) == 1 && seg.parts[0].param() {
+		p := &seg.parts[0]
+		if p.check != nil && !p.check(s) {
+			return false
+		}
+		t.capture(ps, p.name, s)
+		return true
+	}
+	mark := t.mark(ps)
+	if matchParts(t, seg.parts, s, ps) {
+		return true
+	}
+	t.reset(ps, mark)
+	return false
+}
+
+func matchParts(t *Tree, parts []part, s string, ps *Params) bool {
+	if len(parts) == 0 {
+		return s == ""
+	}
+	p := &parts[0]
+	if !p.param() {
+		return strings.HasPrefix(s, p.text) &&
+			matchParts(t, parts[1:], s[len(p.text):], ps)
+	}
+	if len(parts) == 1 {
+		if s == "" || p.check != nil && !p.check(s) {
+			return false
+		}
+		t.capture(ps, p.name, s)
+		return true
+	}
+	// Try the longest value first. The next part is static text.
+	next := parts[1].text
+	for i := strings.LastIndex(s, next); i > 0; i = strings.LastIndex(s[:i+len(next)-1], next) {
+		v := s[:i]
+		if p.check != nil && !p.check(v) {
+			continue
+		}
+		mark := t.mark(ps)
+		t.capture(ps, p.name, v)
+		if matchParts(t, parts[1:], s[i:], ps) {
+			return true
+		}
+		t.reset(ps, mark)
+	}
+	return false
+}
+
+func isUint(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isInt(s string) bool {
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	return isUint(s)
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9') && !isAlpha(s[i:i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9') && !('a' <= c|0x20 && c|0x20 <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i : i+1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -16,6 +16,7 @@ type Node struct {
 	path     string
 	index    string
 	children []Node
+	seg      *segment
 	Payload
 }
 
@@ -29,19 +30,52 @@ const (
 
 func (n *Node) Type() NodeType {
 	switch {
+	case n.seg != nil:
+		return MatchOneNode
 	case n.path == "":
 		return StaticNode
 	case n.path[0] == '*':
 		return MatchAllNode
-	case n.path[0] == ':':
-		return MatchOneNode
 	default:
 		return StaticNode
 	}
 }
 
 type Tree struct {
-	root Node
+	root      Node
+	maxParams int
+}
+
+// Param is a single path parameter captured by a ':name' or '*name'
+// pattern.
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params is an ordered list of captured path parameters.
+type Params []Param
+
+// ByName returns the value of the first parameter named name, or an
+// empty string if there is no such parameter.
+func (ps Params) ByName(name string) string {
+	for i := range ps {
+		if ps[i].Key == name {
+			return ps[i].Value
+		}
+	}
+	return ""
+}
+
+func countParams(path string) (n int) {
+	for _, s := range strings.Split(path, "/") {
+		if firstbyte(s) == '*' {
+			n++
+		} else {
+			n += strings.Count(s, ":")
+		}
+	}
+	return n
 }
 
 func firstbyte(dir string) byte {
@@ -51,35 +85,99 @@ func firstbyte(dir string) byte {
 	return dir[0]
 }
 
+// indexbyte returns the byte of the segment dir in the index of its
+// parent. Parameter segments are indexed by ':' wherever the parameters
+// are, so that they can be found together.
+func indexbyte(dir string) byte {
+	if isParam(dir) {
+		return ':'
+	}
+	return firstbyte(dir)
+}
+
 func newNode(path string) Node {
-	return Node{path: path}
+	n := Node{path: path}
+	if isParam(path) {
+		n.seg = compileSegment(path)
+	}
+	return n
 }
 
-func (node *Node) matchNode() *Node {
-	if i := len(node.index); special(node.index[i-1]) {
-		return &node.children[i-1]
+// rank determines the order of children. Static nodes come first, then
+// parameter nodes with static text such as ":name.json" or "12::30",
+// parameter nodes with constraints, parameter nodes without constraints,
+// and finally the capture-all node.
+func (node *Node) rank() int {
+	switch {
+	case node.seg != nil && node.seg.static > 0:
+		return 1
+	case node.seg != nil && node.seg.parts[0].check != nil:
+		return 2
+	case node.seg != nil:
+		return 3
+	case firstbyte(node.path) == '*':
+		return 4
 	}
-	return nil
+	return 0
 }
 
-func special(b byte) bool {
-	return b == '*' || b == ':'
+// after reports whether node is tried after c in lookup. Parameter nodes
+// with static text are ordered by the length of the static text, and then
+// by the number of constraints.
+func (node *Node) after(c *Node) bool {
+	if r1, r2 := node.rank(), c.rank(); r1 != r2 || r1 != 1 {
+		return r1 > r2
+	}
+	s1, s2 := node.seg, c.seg
+	if s1.static != s2.static {
+		return s1.static < s2.static
+	}
+	return s1.checks < s2.checks
+}
+
+func (node *Node) catchAll() *Node {
+	if i := len(node.index); i > 0 && node.index[i-1] == '*' {
+		return &node.children[i-1]
+	}
+	return nil
 }
 
-func (node *Node) append(c Node) *Node {
-	if i := len(node.index) - 1; i >= 0 && special(node.index[i]) {
-		last := node.children[i]
-		node.index, node.children = node.index[:i], node.children[:i]
-		node.append(c)
-		node.append(last)
-		return &node.children[len(node.children)-2]
+// append inserts c into the child list of node, keeping the children
+// ordered by priority. Functions in f are notified of the existing children
+// that are moved to another memory location.
+func (node *Node) append(c Node, f ...func(old, new *Node)) *Node {
+	pos := len(node.children)
+	for pos > 0 && node.children[pos-1].after(&c) {
+		pos--
 	}
-	node.children = append(node.children, c)
-	node.index = node.index + string(firstbyte(c.path))
-	return &node.children[len(node.children)-1]
+	old := node.children
+	node.children = append(node.children, Node{})
+	copy(node.children[pos+1:], node.children[pos:])
+	node.children[pos] = c
+	node.index = node.index[:pos] + string(indexbyte(c.path)) + node.index[pos:]
+
+	if len(old) > 0 && &old[0] != &node.children[0] {
+		for i := range old {
+			j := i
+			if i >= pos {
+				j++
+			}
+			for _, fn := range f {
+				fn(&old[i], &node.children[j])
+			}
+		}
+		return &node.children[pos]
+	}
+	// Shifted in place, notify from the end to avoid overwriting.
+	for i := len(old) - 1; i >= pos; i-- {
+		for _, fn := range f {
+			fn(&node.children[i], &node.children[i+1])
+		}
+	}
+	return &node.children[pos]
 }
 
-func (node *Node) appendSplit(path string) *Node {
+func (node *Node) appendSplit(path string, f ...func(old, new *Node)) *Node {
 	ss := splitCompact(path)
 	for i, s := range ss {
 		child := newNode(s)
@@ -89,7 +187,7 @@ func (node *Node) appendSplit(path string) *Node {
 				strings.Join(ss[i:], "/"),
 			))
 		}
-		node = node.append(child)
+		node = node.append(child, f...)
 	}
 	return node
 }
@@ -97,11 +195,7 @@ func (node *Node) appendSplit(path string) *Node {
 func splitCompact(path string) (ss []string) {
 	ss = strings.Split(path, "/")
 	special := func(s string) bool {
-		switch firstbyte(s) {
-		case ':', '*':
-			return true
-		}
-		return false
+		return firstbyte(s) == '*' || isParam(s)
 	}
 
 	for i := 0; i < len(ss)-1; {
@@ -117,6 +211,10 @@ func splitCompact(path string) (ss []string) {
 }
 
 func (t *Tree) Add(path string, f ...func(old, new *Node)) *Node {
+	if n := countParams(path); n > t.maxParams {
+		t.maxParams = n
+	}
+	checkConstraints(path)
 	ss := strings.Split(path, "/")
 	return t.root.insert(ss, f...)
 }
@@ -155,7 +253,7 @@ func (node *Node) insert(newpath []string, f ...func(old, new *Node)) *Node {
 			return node
 		}
 		return node.appendSplit(
-			strings.Join(newpath[n:], "/"),
+			strings.Join(newpath[n:], "/"), f...,
 		)
 
 	case n == len(newpath): // Match current node
@@ -165,16 +263,16 @@ func (node *Node) insert(newpath []string, f ...func(old, new *Node)) *Node {
 	// Try to go deeper
 	var (
 		dir      = newpath[n]
-		b        = firstbyte(dir)
+		b        = indexbyte(dir)
 		index    = node.index
 		i        = strings.IndexByte(index, b)
 		children = node.children
 	)
 	for ; i >= 0; i = strings.IndexByte(index, b) {
 		if next := &children[i]; strings.SplitN(next.path, "/", 2)[0] == dir {
-			return next.insert(newpath[n:])
+			return next.insert(newpath[n:], f...)
 		}
-		if b == ':' || b == '*' {
+		if b == '*' || (b == ':' && children[i].seg.shape == compileSegment(dir).shape) {
 			panic(fmt.Errorf(
 				"radix: conflict parameter name: old=%q, new=%q",
 				children[i].path, dir,
@@ -183,78 +281,279 @@ func (node *Node) insert(newpath []string, f ...func(old, new *Node)) *Node {
 		index, children = index[i+1:], children[i+1:]
 	}
 
-	if (b == ':' || b == '*') && node.matchNode() != nil {
-		panic(fmt.Errorf(
-			"radix: conflict parameter type: old=%q, new=%q",
-			node.matchNode().path, dir,
-		))
+	// Failed, append to the child list of current node
+	return node.appendSplit(strings.Join(newpath[n:], "/"), f...)
+}
+
+// Find returns the node of the pattern path, or nil if there is no such
+// node. Unlike Lookup, the parameter segments of path are matched
+// literally.
+func (t *Tree) Find(path string) *Node {
+	return t.root.find(strings.Split(path, "/"))
+}
+
+func (node *Node) find(newpath []string) *Node {
+	var (
+		path = strings.Split(node.path, "/")
+		n    = commonPrefix(path, newpath)
+	)
+	switch {
+	case n < len(path):
+		return nil
+	case n == len(newpath):
+		return node
 	}
+	if i := node.child(newpath[n]); i >= 0 {
+		return node.children[i].find(newpath[n:])
+	}
+	return nil
+}
 
-	// Failed, append to the child list of current node
-	return node.appendSplit(strings.Join(newpath[n:], "/"))
+// child returns the index of the child whose first segment is dir, or -1
+// if there is no such child.
+func (node *Node) child(dir string) int {
+	for i := range node.children {
+		if strings.SplitN(node.children[i].path, "/", 2)[0] == dir {
+			return i
+		}
+	}
+	return -1
 }
 
-func (t *Tree) Lookup(path string) *Node {
-	node := &t.root
-
-OUTER:
-	for len(path) > 0 {
-		// Invariant: path[0] = '/'
-		path = path[1:]
-
-		var (
-			b        = firstbyte(path)
-			index    = node.index
-			i        = strings.IndexByte(index, b)
-			children = node.children
-		)
-		for ; i >= 0; i = strings.IndexByte(index, b) {
-			var (
-				child    = &children[i]
-				pos, min int
-			)
-			if min = len(child.path); min > len(path) {
-				min = len(path)
+// Remove clears the payload of the node of the pattern path, and prunes
+// the nodes that are no longer needed. It reports whether the node had a
+// handler. Functions in f are notified of the nodes that are moved.
+func (t *Tree) Remove(path string, f ...func(old, new *Node)) bool {
+	return t.root.remove(strings.Split(path, "/"), f)
+}
+
+func (node *Node) remove(newpath []string, f []func(old, new *Node)) bool {
+	var (
+		path = strings.Split(node.path, "/")
+		n    = commonPrefix(path, newpath)
+	)
+	switch {
+	case n < len(path):
+		return false
+	case n == len(newpath):
+		removed := node.HandlerFunc != nil
+		node.Payload = Payload{}
+		return removed
+	}
+	i := node.child(newpath[n])
+	if i < 0 || !node.children[i].remove(newpath[n:], f) {
+		return false
+	}
+	node.prune(i, f)
+	return true
+}
+
+// prune removes the i-th child if it has neither a handler nor children,
+// or merges it with its only child if both of them are static.
+func (node *Node) prune(i int, f []func(old, new *Node)) {
+	c := &node.children[i]
+	if c.HandlerFunc != nil {
+		return
+	}
+	switch len(c.children) {
+	case 0:
+		last := len(node.children) - 1
+		copy(node.children[i:], node.children[i+1:])
+		for j := i; j < last; j++ {
+			for _, fn := range f {
+				fn(&node.children[j+1], &node.children[j])
 			}
-			for ; pos < min && child.path[pos] == path[pos]; pos++ {
+		}
+		node.children[last] = Node{}
+		node.children = node.children[:last]
+		node.index = node.index[:i] + node.index[i+1:]
+	case 1:
+		g := &c.children[0]
+		if c.rank() != 0 || g.rank() != 0 {
+			return
+		}
+		merged := *g
+		merged.path = c.path + "/" + g.path
+		*c = merged
+		for _, fn := range f {
+			fn(g, c)
+		}
+	}
+}
+
+func (t *Tree) Lookup(path string) *Node {
+	return t.LookupParams(path, nil)
+}
+
+// LookupParams is like Lookup, but it also appends the values matched by
+// ':name' and '*name' parameters to *ps if ps is not nil. A slice with
+// enough capacity for any route in the tree is allocated if *ps is nil.
+//
+// Only nodes with a handler are matched. If a branch of the tree fails to
+// match the rest of path, the lookup backtracks and tries the next child.
+// Children are tried in the order of priority: static nodes, parameter
+// nodes with static text such as ':name.:ext' (longer static text first),
+// parameter nodes with constraints, plain parameter nodes and finally the
+// capture-all node. A parameter with static text in the same segment
+// matches at least one byte, as many as possible.
+func (t *Tree) LookupParams(path string, ps *Params) *Node {
+	if len(path) == 0 {
+		if t.root.HandlerFunc != nil {
+			return &t.root
+		}
+		return nil
+	}
+	return t.root.lookup(t, path, ps, nil)
+}
+
+// LookupFold is like LookupParams, but static nodes are matched regardless
+// of ASCII case, while static text in parameter segments such as
+// ':name.pdf' is still matched exactly. If several static nodes match, they
+// are tried in the order they were added. LookupFold also returns the path
+// with the static nodes spelled as they are registered, or an empty string
+// if there is no match.
+func (t *Tree) LookupFold(path string, ps *Params) (*Node, string) {
+	if len(path) == 0 {
+		if t.root.HandlerFunc != nil {
+			return &t.root, ""
+		}
+		return nil, ""
+	}
+	buf := make([]byte, 0, len(path))
+	node := t.root.lookup(t, path, ps, &buf)
+	if node == nil {
+		return nil, ""
+	}
+	return node, string(buf)
+}
+
+// lookup matches path, which starts with a slash, against the children of
+// node. If fold is not nil, static nodes are matched case-insensitively and
+// the matched path, as it is registered, is appended to *fold.
+func (node *Node) lookup(t *Tree, path string, ps *Params, fold *[]byte) *Node {
+	path = path[1:]
+
+	var (
+		b        = firstbyte(path)
+		index    = node.index
+		i        = indexByte(index, b, fold != nil)
+		children = node.children
+		mark     = t.mark(ps)
+		n        int
+	)
+	if fold != nil {
+		n = len(*fold)
+	}
+	for ; i >= 0; i = indexByte(index, b, fold != nil) {
+		child := &children[i]
+		if child.rank() == 0 && hasPrefix(path, child.path, fold != nil) {
+			if fold != nil {
+				*fold = append(append((*fold)[:n], '/'), child.path...)
 			}
-			switch {
-			case pos < len(child.path):
-				// Not match
-			case pos == len(path):
-				// Match
-				return child
-			case path[pos] != '/':
-				// Not match
-			default:
-				// Go deeper
-				path = path[pos:]
-				node = child
-				continue OUTER
+			switch rest := path[len(child.path):]; {
+			case rest == "":
+				if child.HandlerFunc != nil {
+					return child
+				}
+			case rest[0] == '/':
+				if c := child.lookup(t, rest, ps, fold); c != nil {
+					return c
+				}
 			}
-			index, children = index[i+1:], children[i+1:]
 		}
+		index, children = index[i+1:], children[i+1:]
+	}
 
-		if l := len(node.index) - 1; l >= 0 {
-			switch node.index[l] {
-			case ':':
-				pos := strings.IndexByte(path, '/')
-				if pos < 0 {
-					pos = len(path)
+	// Parameter nodes follow static nodes, ordered by priority.
+	if i := strings.IndexByte(node.index, ':'); i >= 0 {
+		pos := strings.IndexByte(path, '/')
+		if pos < 0 {
+			pos = len(path)
+		}
+		if fold != nil {
+			*fold = append(append((*fold)[:n], '/'), path[:pos]...)
+		}
+		for ; i < len(node.index) && node.index[i] == ':'; i++ {
+			child := &node.children[i]
+			if !child.seg.match(t, path[:pos], ps) {
+				continue
+			}
+			if pos == len(path) {
+				if child.HandlerFunc != nil {
+					return child
 				}
-				path = path[pos:]
-				node = &node.children[l]
-				continue OUTER
-			case '*':
-				path = path[len(path):]
-				node = &node.children[l]
-				continue OUTER
+			} else if c := child.lookup(t, path[pos:], ps, fold); c != nil {
+				return c
 			}
+			t.reset(ps, mark)
+		}
+	}
+	if c := node.catchAll(); c != nil && c.HandlerFunc != nil {
+		if fold != nil {
+			*fold = append(append((*fold)[:n], '/'), path...)
 		}
+		t.capture(ps, c.path[1:], path)
+		return c
+	}
+	return nil
+}
 
-		return nil
+// indexByte is like strings.IndexByte, but it ignores ASCII case if fold
+// is true.
+func indexByte(s string, c byte, fold bool) int {
+	if !fold || !isLetter(c) {
+		return strings.IndexByte(s, c)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i]|0x20 == c|0x20 {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasPrefix is like strings.HasPrefix, but it ignores ASCII case if fold
+// is true.
+func hasPrefix(s, prefix string, fold bool) bool {
+	if !fold {
+		return strings.HasPrefix(s, prefix)
+	}
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if c := s[i]; c != prefix[i] && (!isLetter(c) || c|0x20 != prefix[i]|0x20) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c|0x20 && c|0x20 <= 'z'
+}
+
+func (t *Tree) capture(ps *Params, key, value string) {
+	if ps == nil {
+		return
+	}
+	if *ps == nil {
+		*ps = make(Params, 0, t.maxParams)
+	}
+	*ps = append(*ps, Param{Key: key, Value: value})
+}
+
+func (t *Tree) mark(ps *Params) int {
+	if ps == nil {
+		return 0
+	}
+	return len(*ps)
+}
+
+func (t *Tree) reset(ps *Params, mark int) {
+	if ps != nil {
+		*ps = (*ps)[:mark]
 	}
-	return node
 }
 
 func (node *Node) String() string {
@@ -350,6 +649,32 @@ func (t *Tree) String() string {
 	return result.String()
 }
 
+// Clone returns a deep copy of t. Functions in f are called with every
+// node of t and its copy.
+func (t *Tree) Clone(f ...func(old, new *Node)) *Tree {
+	c := &Tree{root: t.root, maxParams: t.maxParams}
+	for _, fn := range f {
+		fn(&t.root, &c.root)
+	}
+	c.root.cloneChildren(f)
+	return c
+}
+
+func (node *Node) cloneChildren(f []func(old, new *Node)) {
+	if len(node.children) == 0 {
+		return
+	}
+	old := node.children
+	node.children = make([]Node, len(old))
+	copy(node.children, old)
+	for i := range node.children {
+		for _, fn := range f {
+			fn(&old[i], &node.children[i])
+		}
+		node.children[i].cloneChildren(f)
+	}
+}
+
 func (t *Tree) Optimize(f ...func(old, new *Node)) {
 	var depthfirst, breadthfirst func(*Node, func(*Node))
 
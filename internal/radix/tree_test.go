@@ -3,8 +3,11 @@ package radix
 import (
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -88,6 +91,565 @@ func TestTree_Add(t *testing.T) {
 	}
 }
 
+func TestTree_AddRelocate(t *testing.T) {
+	var (
+		tree  = &Tree{}
+		nodes = make(map[*Node]string)
+		f     = func(old, new *Node) {
+			if p, ok := nodes[old]; ok {
+				delete(nodes, old)
+				nodes[new] = p
+			}
+		}
+		paths = []string{
+			"/a", "/b", "/c/:x", "/c/d", "/c/e", "/c/f/g", "/c/f/h",
+			"/c/i", "/c/j", "/c/k", "/d/*rest", "/d/e", "/d/f", "/d/g",
+			"/ab", "/abc", "/a/b/c", "/a/b/d", "/a/e",
+		}
+	)
+	check := func(t *testing.T) {
+		if len(nodes) != len(paths) {
+			t.Fatalf("got %d nodes, want %d", len(nodes), len(paths))
+		}
+		for n, p := range nodes {
+			if got := tree.Find(p); got != n {
+				t.Errorf("node of %q was moved without notification", p)
+			}
+		}
+	}
+	for _, p := range paths {
+		nodes[tree.Add(p, f)] = p
+	}
+	check(t)
+	tree.Optimize(f)
+	check(t)
+}
+
+func TestTree_Clone(t *testing.T) {
+	tree := &Tree{}
+	paths := []string{"", "/a", "/a/:b", "/a/c/d", "/e/*f"}
+	for _, p := range paths {
+		tree._add(p, makeFunc(p))
+	}
+	moved := make(map[*Node]*Node)
+	clone := tree.Clone(func(old, new *Node) { moved[old] = new })
+	for _, p := range paths {
+		if got, want := clone.Lookup(p), moved[tree.Lookup(p)]; got != want {
+			t.Errorf("clone: Lookup(%q) was not reported", p)
+		}
+	}
+
+	// Modifying the clone doesn't affect the original tree.
+	clone._add("/a/c", makeFunc("/a/c"))
+	clone.Lookup("/a").Replace(makeFunc("replaced"))
+	if v, _ := tree._lookup("/a/c"); fromFunc(v) != "/a/:b" {
+		t.Errorf("Tree.Clone() shares nodes with the original tree")
+	}
+	for _, p := range paths {
+		if got := fromFunc(tree.Lookup(p).HandlerFunc); got != p {
+			t.Errorf("original tree: Lookup(%q) = %v, want %v", p, got, p)
+		}
+	}
+}
+
+func TestTree_Remove(t *testing.T) {
+	var (
+		keep = []string{
+			"", "/pkg", "/pkg/net/http", "/pkg/:first/:second",
+			"/doc/", "/src/*rest", "/abc/x",
+		}
+		remove = []string{
+			"/", "/pkg/", "/pkg/net/html", "/pkg/net/http/httputil",
+			"/pkg/:first", "/pkg/net", "/doc/:doc", "/src/", "/abc",
+			"/a", "/abc/y",
+		}
+		tree  = &Tree{}
+		want  = &Tree{}
+		nodes = make(map[*Node]string)
+		f     = func(old, new *Node) {
+			if p, ok := nodes[old]; ok {
+				delete(nodes, old)
+				nodes[new] = p
+			}
+		}
+	)
+	for _, p := range keep {
+		tree._add(p, makeFunc(p))
+		want._add(p, makeFunc(p))
+	}
+	for _, p := range remove {
+		tree._add(p, makeFunc(p))
+	}
+	for _, p := range keep {
+		nodes[tree.Find(p)] = p
+	}
+	for _, p := range remove {
+		if !tree.Remove(p, f) {
+			t.Errorf("Tree.Remove(%q) = false, want true", p)
+		}
+		if tree.Remove(p, f) {
+			t.Errorf("Tree.Remove(%q) twice = true, want false", p)
+		}
+	}
+	if got, want := tree.String(), want.String(); got != want {
+		t.Errorf("Tree.Remove() got tree\n%s\nwant\n%s", got, want)
+	}
+	for n, p := range nodes {
+		if got := tree.Find(p); got != n {
+			t.Errorf("node of %q was moved without notification", p)
+		}
+		if got := fromFunc(n.HandlerFunc); got != p {
+			t.Errorf("Tree.Find(%q) got = %v, want %v", p, got, p)
+		}
+	}
+}
+
+func TestTree_Constraint(t *testing.T) {
+	RegisterConstraint("even", func(s string) bool {
+		return isUint(s) && (s[len(s)-1]-'0')%2 == 0
+	})
+	tree := &Tree{}
+	for _, p := range []string{
+		"/users/:name",
+		"/users/:id<int>",
+		"/users/:id<even>",
+		"/users/:uuid<uuid>",
+		"/users/:slug<[a-z-]+>/posts",
+		"/users/new",
+		"/users/new/*rest",
+		"/tags/:tag<(beta)>",
+	} {
+		tree._add(p, makeFunc(p))
+	}
+
+	tests := []struct {
+		path   string
+		want   string
+		params Params
+	}{
+		{"/users/new", "/users/new", nil},
+		{"/users/new/a/b", "/users/new/*rest", Params{{"rest", "a/b"}}},
+		{"/users/42", "/users/:id<int>", Params{{"id", "42"}}},
+		{"/users/-1", "/users/:id<int>", Params{{"id", "-1"}}},
+		{"/users/43", "/users/:id<int>", Params{{"id", "43"}}},
+		{"/users/BOB", "/users/:name", Params{{"name", "BOB"}}},
+		{"/users/a-b/posts", "/users/:slug<[a-z-]+>/posts", Params{{"slug", "a-b"}}},
+		{"/tags/beta", "/tags/:tag<(beta)>", Params{{"tag", "beta"}}},
+		{
+			"/users/123e4567-e89b-12d3-a456-426614174000", "/users/:uuid<uuid>",
+			Params{{"uuid", "123e4567-e89b-12d3-a456-426614174000"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var ps Params
+			node := tree.LookupParams(tt.path, &ps)
+			if node == nil || node.HandlerFunc == nil {
+				t.Fatalf("Tree.LookupParams() = nil")
+			}
+			if got := fromFunc(node.HandlerFunc); got != tt.want {
+				t.Errorf("Tree.LookupParams() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(ps, tt.params) {
+				t.Errorf("Tree.LookupParams() params = %v, want %v", ps, tt.params)
+			}
+		})
+	}
+
+	for _, p := range []string{
+		"/users/:other",
+		"/users/:other<int>",
+		"/users/:other<",
+		"/users/:other<[a->",
+		"/users/:other<innt>",
+		"/users/new/*other",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Tree.Add(%q): want panic", p)
+				}
+			}()
+			tree.Add(p)
+		}()
+	}
+}
+
+func TestTree_ConstraintSlash(t *testing.T) {
+	for _, p := range []string{
+		"/files/:name<[^/]+>",
+		"/files/:name<a/b>/x",
+		"/files/x:name<(a|b/c)>",
+	} {
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if err == nil || !strings.Contains(err.Error(), "contains '/'") {
+					t.Errorf("Tree.Add(%q): got panic %v, want a constraint containing '/'", p, err)
+				}
+			}()
+			(&Tree{}).Add(p)
+		}()
+	}
+	// '/' after a constraint is fine.
+	tree := &Tree{}
+	tree._add("/files/:name<[a-z]+>/:id<int>", makeFunc("ok"))
+	if tree.Lookup("/files/a/1") == nil {
+		t.Errorf("Tree.Lookup() = nil")
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	tests := []struct {
+		f    func(string) bool
+		s    string
+		want bool
+	}{
+		{isInt, "", false},
+		{isInt, "-", false},
+		{isInt, "-12", true},
+		{isUint, "-12", false},
+		{isUint, "0123", true},
+		{isAlpha, "abcXYZ", true},
+		{isAlpha, "ab1", false},
+		{isAlnum, "ab1Z", true},
+		{isAlnum, "a-b", false},
+		{isHex, "09afAF", true},
+		{isHex, "0g", false},
+		{isUUID, "123e4567-e89b-12d3-a456-426614174000", true},
+		{isUUID, "123e4567e89b12d3a456426614174000", false},
+		{isUUID, "123e4567-e89b-12d3-a456-42661417400g", false},
+	}
+	for _, tt := range tests {
+		if got := tt.f(tt.s); got != tt.want {
+			t.Errorf("constraint(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTree_Template(t *testing.T) {
+	tree := &Tree{}
+	for _, p := range []string{
+		"/files/:name.:ext",
+		"/files/:name",
+		"/files/:name.tar.gz",
+		"/files/readme.md",
+		"/v:version/items",
+		"/v:version<int>/items",
+		"/img/:id<int>.png",
+		"/img/:id.png",
+		"/img/*rest",
+		"/a/x:a-:b<int>y",
+		"/time/12::30",
+		"/time/:h<int>:::m<int>",
+	} {
+		tree._add(p, makeFunc(p))
+	}
+
+	tests := []struct {
+		path   string
+		want   string
+		params Params
+	}{
+		{"/files/readme.md", "/files/readme.md", nil},
+		{"/files/a.txt", "/files/:name.:ext", Params{{"name", "a"}, {"ext", "txt"}}},
+		{"/files/a.b.c", "/files/:name.:ext", Params{{"name", "a.b"}, {"ext", "c"}}},
+		{"/files/a.tar.gz", "/files/:name.tar.gz", Params{{"name", "a"}}},
+		{"/files/a", "/files/:name", Params{{"name", "a"}}},
+		{"/files/.txt", "/files/:name", Params{{"name", ".txt"}}},
+		{"/files/a.", "/files/:name", Params{{"name", "a."}}},
+		{"/v2/items", "/v:version<int>/items", Params{{"version", "2"}}},
+		{"/vbeta/items", "/v:version/items", Params{{"version", "beta"}}},
+		{"/img/42.png", "/img/:id<int>.png", Params{{"id", "42"}}},
+		{"/img/x.png", "/img/:id.png", Params{{"id", "x"}}},
+		{"/img/x.jpg", "/img/*rest", Params{{"rest", "x.jpg"}}},
+		{"/a/x1-2-3y", "/a/x:a-:b<int>y", Params{{"a", "1-2"}, {"b", "3"}}},
+		{"/a/x1-2-y", "", nil},
+		{"/vbeta", "", nil},
+		{"/time/12:30", "/time/12::30", nil},
+		{"/time/12:31", "/time/:h<int>:::m<int>", Params{{"h", "12"}, {"m", "31"}}},
+		{"/time/12xx", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var ps Params
+			node := tree.LookupParams(tt.path, &ps)
+			if tt.want == "" {
+				if node != nil {
+					t.Fatalf("Tree.LookupParams() = %v, want nil", node)
+				}
+				return
+			}
+			if node == nil || node.HandlerFunc == nil {
+				t.Fatalf("Tree.LookupParams() = nil")
+			}
+			if got := fromFunc(node.HandlerFunc); got != tt.want {
+				t.Errorf("Tree.LookupParams() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(ps, tt.params) {
+				t.Errorf("Tree.LookupParams() params = %v, want %v", ps, tt.params)
+			}
+		})
+	}
+
+	for _, p := range []string{
+		"/files/:base.:suffix",
+		"/v:v/items",
+		"/img/:a:b",
+		"/img/:a<int:b",
+		"/time/12:30",
+		"/files/:.x",
+		"/files/x:",
+		"/files/:1a",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Tree.Add(%q): want panic", p)
+				}
+			}()
+			tree.Add(p)
+		}()
+	}
+}
+
+func TestTree_LookupFold(t *testing.T) {
+	tree := &Tree{}
+	for _, p := range []string{
+		"/Users/:Name/Profile",
+		"/users/new",
+		"/static/*Path",
+		"/files/:name.PDF",
+		"/a/b/c",
+		"/a/B/d",
+	} {
+		tree._add(p, makeFunc(p))
+	}
+
+	tests := []struct {
+		path      string
+		want      string
+		canonical string
+		params    Params
+	}{
+		{"/users/bob/profile", "/Users/:Name/Profile", "/Users/bob/Profile", Params{{"Name", "bob"}}},
+		{"/USERS/NEW", "/users/new", "/users/new", nil},
+		{"/STATIC/A/b", "/static/*Path", "/static/A/b", Params{{"Path", "A/b"}}},
+		{"/FILES/X.PDF", "/files/:name.PDF", "/files/X.PDF", Params{{"name", "X"}}},
+		{"/A/b/D", "/a/B/d", "/a/B/d", nil},
+		{"/a/b/C", "/a/b/c", "/a/b/c", nil},
+		{"/usersx/new", "", "", nil},
+		{"/files/x.pdf", "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var ps Params
+			node, canonical := tree.LookupFold(tt.path, &ps)
+			if tt.want == "" {
+				if node != nil || canonical != "" {
+					t.Fatalf("Tree.LookupFold() = %v, %q, want nil", node, canonical)
+				}
+				return
+			}
+			if node == nil {
+				t.Fatalf("Tree.LookupFold() = nil")
+			}
+			if got := fromFunc(node.HandlerFunc); got != tt.want {
+				t.Errorf("Tree.LookupFold() got = %v, want %v", got, tt.want)
+			}
+			if canonical != tt.canonical {
+				t.Errorf("Tree.LookupFold() path = %q, want %q", canonical, tt.canonical)
+			}
+			if (len(ps) > 0 || len(tt.params) > 0) && !reflect.DeepEqual(ps, tt.params) {
+				t.Errorf("Tree.LookupFold() params = %v, want %v", ps, tt.params)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	values := map[string]string{"name": "a", "ext": "txt", "rest": "x/y"}
+	f := func(name string, all bool) (string, error) {
+		if all {
+			return "[" + values[name] + "]", nil
+		}
+		return values[name], nil
+	}
+	for pattern, want := range map[string]string{
+		"/files/:name.:ext":     "/files/a.txt",
+		"/v:name<int>/*rest":    "/va/[x/y]",
+		"/static/:name/n:ext.x": "/static/a/ntxt.x",
+		"/time/12::30/:name":    "/time/12:30/a",
+	} {
+		if got, err := Expand(pattern, f); err != nil || got != want {
+			t.Errorf("Expand(%q) = %q, %v, want %q", pattern, got, err, want)
+		}
+	}
+}
+
+func TestTree_Backtrack(t *testing.T) {
+	tree := &Tree{}
+	for _, p := range []string{
+		"/pkg/net",
+		"/pkg/net/http",
+		"/pkg/:first/:second",
+		"/pkg/*rest",
+		"/doc/:id<int>/x",
+		"/doc/:name/y",
+		"/src/a/b",
+		"/src/:dir",
+	} {
+		tree._add(p, makeFunc(p))
+	}
+
+	tests := []struct {
+		path   string
+		want   string
+		params Params
+	}{
+		{"/pkg/net", "/pkg/net", nil},
+		{"/pkg/net/http", "/pkg/net/http", nil},
+		{"/pkg/net/x", "/pkg/:first/:second", Params{{"first", "net"}, {"second", "x"}}},
+		{"/pkg/net/x/y", "/pkg/*rest", Params{{"rest", "net/x/y"}}},
+		{"/pkg/x", "/pkg/*rest", Params{{"rest", "x"}}},
+		{"/doc/1/x", "/doc/:id<int>/x", Params{{"id", "1"}}},
+		{"/doc/1/y", "/doc/:name/y", Params{{"name", "1"}}},
+		{"/src/a", "/src/:dir", Params{{"dir", "a"}}},
+		{"/src/a/c", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var ps Params
+			node := tree.LookupParams(tt.path, &ps)
+			if tt.want == "" {
+				if node != nil {
+					t.Fatalf("Tree.LookupParams() = %v, want nil", node)
+				}
+				return
+			}
+			if node == nil {
+				t.Fatalf("Tree.LookupParams() = nil")
+			}
+			if got := fromFunc(node.HandlerFunc); got != tt.want {
+				t.Errorf("Tree.LookupParams() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(ps, tt.params) {
+				t.Errorf("Tree.LookupParams() params = %v, want %v", ps, tt.params)
+			}
+		})
+	}
+}
+
+// naiveLookup is the reference matcher for Tree.Lookup. It matches path
+// against every pattern segment by segment, and picks the match whose
+// sequence of segment kinds (static < parameter < capture-all) is the
+// smallest.
+func naiveLookup(patterns []string, path string) (best string, bestPs Params) {
+	var bestKinds []int
+	ss := strings.Split(path, "/")
+	for _, p := range patterns {
+		var (
+			kinds []int
+			ps    Params
+			ok    = true
+		)
+		pp := strings.Split(p, "/")
+		for i, seg := range pp {
+			switch {
+			case strings.HasPrefix(seg, "*"):
+				if i >= len(ss) {
+					ok = false
+					break
+				}
+				kinds = append(kinds, 2)
+				ps = append(ps, Param{seg[1:], strings.Join(ss[i:], "/")})
+			case i >= len(ss):
+				ok = false
+			case strings.HasPrefix(seg, ":"):
+				kinds = append(kinds, 1)
+				ps = append(ps, Param{seg[1:], ss[i]})
+			case seg != ss[i]:
+				ok = false
+			default:
+				kinds = append(kinds, 0)
+			}
+			if !ok || seg != "" && seg[0] == '*' {
+				break
+			}
+		}
+		if !ok || (!strings.Contains(p, "*") && len(pp) != len(ss)) {
+			continue
+		}
+		if best == "" || lessKinds(kinds, bestKinds) {
+			best, bestPs, bestKinds = p, ps, kinds
+		}
+	}
+	return best, bestPs
+}
+
+func lessKinds(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func TestTree_LookupReference(t *testing.T) {
+	bt, err := ioutil.ReadFile(filepath.Join("testdata", "url.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := strings.Split(strings.TrimSpace(string(bt)), "\n")
+	rnd := rand.New(rand.NewSource(1))
+
+	// randomPattern derives a pattern from a URL of the corpus by
+	// replacing some of its segments with parameters.
+	randomPattern := func() string {
+		ss := strings.Split(urls[rnd.Intn(len(urls))], "/")
+		for i := 1; i < len(ss); i++ {
+			switch rnd.Intn(6) {
+			case 0:
+				ss[i] = ":p" + strconv.Itoa(i)
+			case 1:
+				return strings.Join(append(ss[:i], "*rest"), "/")
+			}
+		}
+		return strings.Join(ss, "/")
+	}
+
+	for round := 0; round < 50; round++ {
+		var (
+			tree     = &Tree{}
+			patterns []string
+			seen     = make(map[string]bool)
+		)
+		for i := 0; i < 1+rnd.Intn(40); i++ {
+			p := randomPattern()
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			patterns = append(patterns, p)
+			tree._add(p, makeFunc(p))
+		}
+		for _, u := range urls {
+			want, wantPs := naiveLookup(patterns, u)
+			var ps Params
+			node := tree.LookupParams(u, &ps)
+			got := ""
+			if node != nil {
+				got = fromFunc(node.HandlerFunc)
+			}
+			if got != want || (got != "" && !reflect.DeepEqual(ps, wantPs)) {
+				t.Fatalf("patterns %q\nLookup(%q) = %q %v, want %q %v",
+					patterns, u, got, ps, want, wantPs)
+			}
+		}
+	}
+}
+
 func (t *Tree) _lookup(path string) (v http.HandlerFunc, ok bool) {
 	node := t.Lookup(path)
 	if node == nil || node.HandlerFunc == nil {
@@ -180,6 +742,51 @@ func TestTree_Lookup(t *testing.T) {
 	})
 }
 
+func TestTree_LookupParams(t *testing.T) {
+	tree := &Tree{}
+	for _, p := range []string{
+		"/pkg/net",
+		"/pkg/:first",
+		"/pkg/:first/:second",
+		"/pkg/:first/:second/*rest",
+		"/src/*",
+	} {
+		tree._add(p, makeFunc(p))
+	}
+
+	tests := []struct {
+		path string
+		want Params
+	}{
+		{"/pkg/net", nil},
+		{"/pkg/1", Params{{"first", "1"}}},
+		{"/pkg/1/", Params{{"first", "1"}, {"second", ""}}},
+		{"/pkg/1/2", Params{{"first", "1"}, {"second", "2"}}},
+		{"/pkg/1/2/", Params{{"first", "1"}, {"second", "2"}, {"rest", ""}}},
+		{"/pkg/1/2/3/4", Params{{"first", "1"}, {"second", "2"}, {"rest", "3/4"}}},
+		{"/src/a/b", Params{{"", "a/b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var ps Params
+			if node := tree.LookupParams(tt.path, &ps); node == nil {
+				t.Fatalf("Tree.LookupParams() = nil")
+			}
+			if !reflect.DeepEqual(ps, tt.want) {
+				t.Errorf("Tree.LookupParams() params = %v, want %v", ps, tt.want)
+			}
+			for _, p := range tt.want {
+				if got := ps.ByName(p.Key); got != p.Value {
+					t.Errorf("Params.ByName(%q) = %q, want %q", p.Key, got, p.Value)
+				}
+			}
+			if cap(ps) > 0 && cap(ps) != tree.maxParams {
+				t.Errorf("cap(params) = %d, want %d", cap(ps), tree.maxParams)
+			}
+		})
+	}
+}
+
 /*
 
 BenchmarkLookup/optimized-4         	30000000	        40.9 ns/op
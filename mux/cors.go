@@ -0,0 +1,161 @@
+package mux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerOrigin                        = "Origin"
+	headerVary                          = "Vary"
+	headerAccessControlRequestMethod    = "Access-Control-Request-Method"
+	headerAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	headerAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	headerAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	headerAccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
+// CORS is a cross-origin resource sharing policy. It is a Middleware that
+// sets the CORS response headers for actual requests, and it is used by the
+// automatic OPTIONS handler to answer preflight requests. Attach it to all
+// routes with Mux.Use, or to the routes of a group with Group.Use.
+type CORS struct {
+	// AllowedOrigins is the list of origins that may access the
+	// resource. "*" allows any origin, but never with credentials: only
+	// the origins listed explicitly are allowed credentials.
+	AllowedOrigins []string
+	// AllowedHeaders is the list of request headers that may be used in
+	// the actual request. "*" allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders is the list of response headers that are exposed
+	// to the client.
+	ExposedHeaders []string
+	// AllowCredentials indicates whether the response can be exposed
+	// when the request includes credentials, to the origins listed in
+	// AllowedOrigins.
+	AllowCredentials bool
+	// MaxAge indicates how long the result of a preflight request can be
+	// cached. Zero means that the header is not sent.
+	MaxAge time.Duration
+}
+
+func (c *CORS) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// The response depends on Origin even if the request has none, so
+		// that caches don't serve it to cross-origin requests.
+		header := rw.Header()
+		header.Add(headerVary, headerOrigin)
+		if origin := req.Header.Get(headerOrigin); origin != "" {
+			if c.allowOrigin(header, origin) && len(c.ExposedHeaders) > 0 {
+				header.Set(
+					headerAccessControlExposeHeaders,
+					strings.Join(c.ExposedHeaders, ", "),
+				)
+			}
+		}
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// allowOrigin sets the headers allowing origin, if it's allowed. Listed
+// origins are allowed with credentials if AllowCredentials is true, while
+// "*" allows any other origin without credentials.
+func (c *CORS) allowOrigin(header http.Header, origin string) bool {
+	for _, s := range c.AllowedOrigins {
+		if s == origin && s != "*" {
+			header.Set(headerAccessControlAllowOrigin, origin)
+			if c.AllowCredentials {
+				header.Set(headerAccessControlAllowCredentials, "true")
+			}
+			return true
+		}
+	}
+	for _, s := range c.AllowedOrigins {
+		if s == "*" {
+			header.Set(headerAccessControlAllowOrigin, "*")
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORS) allowHeaders(requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		ok := false
+		for _, s := range c.AllowedHeaders {
+			if s == "*" || strings.EqualFold(s, h) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CORS) preflight(header http.Header, req *http.Request) {
+	origin := req.Header.Get(headerOrigin)
+	header.Add(headerVary, headerOrigin)
+	requested := req.Header.Get(headerAccessControlRequestHeaders)
+	if !c.allowHeaders(requested) || !c.allowOrigin(header, origin) {
+		return
+	}
+	header.Set(
+		headerAccessControlAllowMethods,
+		req.Header.Get(headerAccessControlRequestMethod),
+	)
+	if requested != "" {
+		header.Set(headerAccessControlAllowHeaders, requested)
+	}
+	if c.MaxAge > 0 {
+		header.Set(
+			headerAccessControlMaxAge,
+			strconv.Itoa(int(c.MaxAge/time.Second)),
+		)
+	}
+}
+
+// cors returns the innermost CORS policy of the route that would serve
+// a request of method to path.
+func (mux *Mux) cors(tab *table, method, path string) *CORS {
+	var ep *endpoint
+	if t := tab.tree(method); t != nil {
+		ep = tab.endpoint[t.Lookup(path)]
+	}
+	if ep == nil && method == HEAD && mux.AutoHead {
+		ep = tab.endpoint[tab.tree(GET).Lookup(path)]
+	}
+	if ep == nil || ep.redirect {
+		return nil
+	}
+	for i := len(ep.middlewares) - 1; i >= 0; i-- {
+		if c, ok := ep.middlewares[i].(*CORS); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+func (mux *Mux) options(tab *table, rw http.ResponseWriter,
+	req *http.Request, path string, methods []string) {
+
+	header := rw.Header()
+	if method := req.Header.Get(headerAccessControlRequestMethod); method != "" &&
+		req.Header.Get(headerOrigin) != "" {
+		if c := mux.cors(tab, method, path); c != nil {
+			c.preflight(header, req)
+		}
+	}
+	header.Set("Allow", strings.Join(methods, ", "))
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,194 @@
+package mux_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/httpx/mux"
+)
+
+func TestAutoOptions(t *testing.T) {
+	m := mux.New()
+	m.GET("/a", H{t: t, method: "GET"})
+	m.POST("/a", H{t: t, method: "POST"})
+	m.GET("/b", H{t: t, method: "GET"})
+	m.Handle("OPTIONS", "/b", H{t: t, method: "OPTIONS", i: 1})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"/a", 204, "GET, HEAD, OPTIONS, POST"},
+		{"/b", 200, ""},
+		{"/c", 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest("OPTIONS", tt.path, nil))
+			if got, want := rec.Code, tt.wantStatus; got != want {
+				t.Errorf("got status %v, want %v", got, want)
+			}
+			if got, want := rec.Header().Get("Allow"), tt.wantAllow; got != want {
+				t.Errorf("got Allow header %q, want %q", got, want)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		m := mux.New(mux.AutoOptions(false))
+		m.GET("/a", H{t: t, method: "GET"})
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/a", nil))
+		if got, want := rec.Code, 405; got != want {
+			t.Errorf("got status %v, want %v", got, want)
+		}
+		if got, want := rec.Header().Get("Allow"), "GET, HEAD"; got != want {
+			t.Errorf("got Allow header %q, want %q", got, want)
+		}
+	})
+}
+
+func TestCORS(t *testing.T) {
+	m := mux.New()
+	m.GET("/public", H{t: t, method: "GET"})
+	api := m.Group("/api")
+	api.Use(&mux.CORS{
+		AllowedOrigins:   []string{"https://example.com"},
+		AllowedHeaders:   []string{"Content-Type"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	api.PUT("/items/:id", H{t: t, method: "PUT"})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   map[string]string
+		want     map[string]string
+		wantCode int
+	}{
+		{
+			"preflight", "OPTIONS", "/api/items/1",
+			map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "content-type",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Methods":     "PUT",
+				"Access-Control-Allow-Headers":     "content-type",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Allow":                            "OPTIONS, PUT",
+			},
+			204,
+		},
+		{
+			"preflight with disallowed origin", "OPTIONS", "/api/items/1",
+			map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+			204,
+		},
+		{
+			"preflight with disallowed header", "OPTIONS", "/api/items/1",
+			map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+			204,
+		},
+		{
+			"preflight without policy", "OPTIONS", "/public",
+			map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Allow":                       "GET, HEAD, OPTIONS",
+			},
+			204,
+		},
+		{
+			"actual request", "PUT", "/api/items/1",
+			map[string]string{"Origin": "https://example.com"},
+			map[string]string{
+				"Access-Control-Allow-Origin":   "https://example.com",
+				"Access-Control-Expose-Headers": "X-Total",
+				"Vary":                          "Origin",
+			},
+			200,
+		},
+		{
+			"actual request without origin", "PUT", "/api/items/1",
+			nil,
+			map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Origin",
+			},
+			200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, req)
+			if got, want := rec.Code, tt.wantCode; got != want {
+				t.Errorf("got status %v, want %v", got, want)
+			}
+			for k, want := range tt.want {
+				if got := rec.Header().Get(k); got != want {
+					t.Errorf("got header %s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSWildcardCredentials(t *testing.T) {
+	m := mux.New()
+	m.Use(&mux.CORS{
+		AllowedOrigins:   []string{"*", "https://example.com"},
+		AllowCredentials: true,
+	})
+	m.GET("/a", H{t: t, method: "GET"})
+
+	for _, tt := range []struct {
+		origin, allow, credentials string
+	}{
+		{"https://example.com", "https://example.com", "true"},
+		{"https://evil.com", "*", ""},
+	} {
+		req := httptest.NewRequest("GET", "/a", nil)
+		req.Header.Set("Origin", tt.origin)
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+			t.Errorf("Origin %s: got Access-Control-Allow-Origin %q, want %q", tt.origin, got, tt.allow)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+			t.Errorf("Origin %s: got Access-Control-Allow-Credentials %q, want %q", tt.origin, got, tt.credentials)
+		}
+	}
+}
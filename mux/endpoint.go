@@ -2,33 +2,103 @@ package mux
 
 import (
 	"net/http"
+	"sort"
 
 	"github.com/fanyang01/httpx/internal/radix"
 )
 
 type endpoint struct {
-	method      string
+	route *Route
+	// pattern is the pattern of the node, which is one of the expanded
+	// patterns of route.
+	pattern string
+	// group is the group the route was registered on, and own are the
+	// middlewares added by Route.Use. middlewares is the resolved chain,
+	// and gen is the generation of the middlewares of the mux it was
+	// resolved at.
+	group       *Group
+	own         []Middleware
 	middlewares []Middleware
+	gen         int
 	handler     http.Handler
 	combined    *radix.Node
+	redirect    bool
 }
 
-func (mux *Mux) record(method string, p string,
-	h http.Handler, node *radix.Node, ms []Middleware) {
+func (mux *Mux) record(r *Route, pattern string,
+	h http.Handler, node *radix.Node, g *Group, ms []Middleware) {
 
-	cn := mux.combined.Add(p, mux.updateCombined)
+	cn := mux.combined.Add(pattern, mux.updateCombined)
 	cn.Replace(mux.MethodNotAllowed.ServeHTTP)
 	mux.link[cn] = append(mux.link[cn], node)
+	mux.addMethod(r.method)
 	mux.endpoint[node] = &endpoint{
-		method:      method,
+		route:       r,
+		pattern:     pattern,
+		group:       g,
 		handler:     h,
 		combined:    cn,
 		middlewares: ms,
+		gen:         mux.gen,
 	}
 }
 
+// recordRedirect records a redirection added by StrictSlash. It doesn't
+// appear in the combined tree.
+func (mux *Mux) recordRedirect(r *Route, node *radix.Node) {
+	mux.endpoint[node] = &endpoint{
+		route:    r,
+		pattern:  r.pattern,
+		redirect: true,
+	}
+}
+
+// unrecord removes the bookkeeping of a route, including its node in the
+// combined tree if no other method uses the pattern. The name of the route
+// is released with its last pattern.
+func (mux *Mux) unrecord(node *radix.Node, ep *endpoint) {
+	delete(mux.endpoint, node)
+	if name := ep.route.name; name != "" && mux.names[name] == ep.route &&
+		len(mux.registered(ep.route)) == 0 {
+		delete(mux.names, name)
+	}
+	cn := ep.combined
+	nodes := mux.link[cn]
+	for i, n := range nodes {
+		if n == node {
+			nodes = append(nodes[:i], nodes[i+1:]...)
+			break
+		}
+	}
+	if len(nodes) > 0 {
+		mux.link[cn] = nodes
+		return
+	}
+	delete(mux.link, cn)
+	mux.combined.Remove(ep.pattern, mux.updateCombined)
+}
+
+// registered returns the expanded patterns of r that are still registered
+// in t.
+func (t *table) registered(r *Route) []string {
+	tr := t.tree(r.method)
+	if tr == nil {
+		return nil
+	}
+	var ps []string
+	for _, p := range r.expanded() {
+		if ep, ok := t.endpoint[tr.Find(p)]; ok && ep.route == r {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
 func (mux *Mux) updateEndpoint(old, new *radix.Node) {
-	p := mux.endpoint[old]
+	p, ok := mux.endpoint[old]
+	if !ok {
+		return
+	}
 	delete(mux.endpoint, old)
 	mux.endpoint[new] = p
 	cn := p.combined
@@ -41,10 +111,49 @@ func (mux *Mux) updateEndpoint(old, new *radix.Node) {
 }
 
 func (mux *Mux) updateCombined(old, new *radix.Node) {
-	nodes := mux.link[old]
+	nodes, ok := mux.link[old]
+	if !ok {
+		return
+	}
 	delete(mux.link, old)
 	mux.link[new] = nodes
 	for _, n := range nodes {
 		mux.endpoint[n].combined = new
 	}
 }
+
+func (mux *Mux) addMethod(method string) {
+	mux.methods = insertSorted(mux.methods, method)
+}
+
+// insertSorted inserts s into the sorted slice ss if it's not present.
+func insertSorted(ss []string, s string) []string {
+	i := sort.SearchStrings(ss, s)
+	if i < len(ss) && ss[i] == s {
+		return ss
+	}
+	ss = append(ss, "")
+	copy(ss[i+1:], ss[i:])
+	ss[i] = s
+	return ss
+}
+
+// allowed returns the sorted list of methods that have a route matching
+// path. StrictSlash redirections are not taken into account. HEAD and
+// OPTIONS are included if they are served implicitly.
+func (mux *Mux) allowed(tab *table, path string) []string {
+	var methods []string
+	for _, method := range tab.methods {
+		node := tab.tree(method).Lookup(path)
+		if ep, ok := tab.endpoint[node]; ok && !ep.redirect {
+			methods = insertSorted(methods, method)
+			if method == GET && mux.AutoHead {
+				methods = insertSorted(methods, HEAD)
+			}
+		}
+	}
+	if len(methods) > 0 && mux.AutoOptions {
+		methods = insertSorted(methods, OPTIONS)
+	}
+	return methods
+}
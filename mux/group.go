@@ -6,8 +6,11 @@ import (
 )
 
 type Group struct {
-	mux         *Mux
-	prefix      string
+	mux    *Mux
+	parent *Group
+	prefix string
+	// middlewares are the ones added to this group, not including those
+	// of the parent groups.
 	middlewares []Middleware
 }
 
@@ -28,15 +31,53 @@ func (f MiddlewareFunc) Wrap(h http.Handler) http.Handler {
 	return f(h)
 }
 
+// Use adds middlewares to g. They apply to all routes of g and its
+// subgroups, including those registered before the call, inside the
+// middlewares of the mux and the parent groups.
 func (g *Group) Use(middlewares ...Middleware) {
-	g.middlewares = append(g.middlewares, middlewares...)
+	mux := g.mux
+	mux.update(func() {
+		g.middlewares = append(g.middlewares, middlewares...)
+		mux.invalidate()
+	})
 }
 
+// Group returns a subgroup of g. Middlewares added to g later apply to the
+// subgroup too, while those added to the subgroup don't apply to g.
 func (g *Group) Group(prefix string) *Group {
+	return &Group{
+		mux:    g.mux,
+		parent: g,
+		prefix: concat(g.prefix, prefix),
+	}
+}
+
+// chain returns the middlewares of g and its parents, outermost first.
+func (g *Group) chain() []Middleware {
+	if g == nil {
+		return nil
+	}
+	return append(g.parent.chain(), g.middlewares...)
+}
+
+// With returns a group without prefix whose routes are wrapped by
+// middlewares, e.g. mux.With(auth).GET("/admin", h). The middlewares wrap
+// the handler inside the ones added by Mux.Use.
+func (mux *Mux) With(middlewares ...Middleware) *Group {
+	return &Group{
+		mux:         mux,
+		middlewares: append([]Middleware(nil), middlewares...),
+	}
+}
+
+// With returns a subgroup of g with the same prefix whose routes are also
+// wrapped by middlewares, inside the middlewares of g.
+func (g *Group) With(middlewares ...Middleware) *Group {
 	return &Group{
 		mux:         g.mux,
-		prefix:      concat(g.prefix, prefix),
-		middlewares: g.middlewares,
+		parent:      g,
+		prefix:      g.prefix,
+		middlewares: append([]Middleware(nil), middlewares...),
 	}
 }
 
@@ -51,31 +92,60 @@ func concat(prefix, s string) string {
 	return prefix + s
 }
 
-func (g *Group) add(method, pattern string, h http.Handler) {
-	pattern = concat(g.prefix, pattern)
-	g.mux.add(method, pattern, h, g.middlewares...)
+func (g *Group) add(method, pattern string, h http.Handler) *Route {
+	return g.mux.add(method, g, concat(g.prefix, pattern), h)
+}
+
+func (g *Group) Handle(method, pattern string, h http.Handler) *Route {
+	return g.add(method, pattern, h)
+}
+
+func (g *Group) GET(pattern string, h http.Handler) *Route {
+	return g.add(xGET, pattern, h)
+}
+
+func (g *Group) HEAD(pattern string, h http.Handler) *Route {
+	return g.add(xHEAD, pattern, h)
+}
+
+func (g *Group) POST(pattern string, h http.Handler) *Route {
+	return g.add(xPOST, pattern, h)
+}
+
+func (g *Group) PUT(pattern string, h http.Handler) *Route {
+	return g.add(xPUT, pattern, h)
+}
+
+func (g *Group) DELETE(pattern string, h http.Handler) *Route {
+	return g.add(xDELETE, pattern, h)
+}
+
+func (g *Group) PATCH(pattern string, h http.Handler) *Route {
+	return g.add(xPATCH, pattern, h)
 }
 
-func (g *Group) Handle(method, pattern string, h http.Handler) {
-	g.add(method, pattern, h)
+func (g *Group) OPTIONS(pattern string, h http.Handler) *Route {
+	return g.add(xOPTIONS, pattern, h)
 }
 
-func (g *Group) GET(pattern string, h http.Handler) {
-	g.add(xGET, pattern, h)
+func (g *Group) TRACE(pattern string, h http.Handler) *Route {
+	return g.add(xTRACE, pattern, h)
 }
 
-func (g *Group) HEAD(pattern string, h http.Handler) {
-	g.add(xHEAD, pattern, h)
+func (g *Group) CONNECT(pattern string, h http.Handler) *Route {
+	return g.add(xCONNECT, pattern, h)
 }
 
-func (g *Group) POST(pattern string, h http.Handler) {
-	g.add(xPOST, pattern, h)
+func (g *Group) HandleFunc(method, pattern string, f http.HandlerFunc) *Route {
+	return g.add(method, pattern, f)
 }
 
-func (g *Group) PUT(pattern string, h http.Handler) {
-	g.add(xPUT, pattern, h)
+// Match is like Mux.Match, but pattern is relative to the prefix of g.
+func (g *Group) Match(methods []string, pattern string, h http.Handler) []*Route {
+	return g.mux.addAll(methods, g, concat(g.prefix, pattern), h)
 }
 
-func (g *Group) DELETE(pattern string, h http.Handler) {
-	g.add(xDELETE, pattern, h)
+// Any is like Mux.Any, but pattern is relative to the prefix of g.
+func (g *Group) Any(pattern string, h http.Handler) []*Route {
+	return g.mux.addAll(anyMethods, g, concat(g.prefix, pattern), h)
 }
@@ -0,0 +1,174 @@
+package mux_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fanyang01/httpx/mux"
+)
+
+// tag is a middleware that writes its name before calling the handler.
+type tag string
+
+func (t tag) Name() string { return string(t) }
+func (t tag) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		io.WriteString(rw, string(t))
+		h.ServeHTTP(rw, req)
+	})
+}
+
+var dot = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+	io.WriteString(rw, ".")
+})
+
+func serve(m *mux.Mux, method, path string) string {
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec.Body.String()
+}
+
+func TestWith(t *testing.T) {
+	m := mux.New()
+	m.Use(tag("m"))
+	m.GET("/a", dot)
+	m.With(tag("w")).GET("/b", dot).Use(tag("r1")).Use(tag("r2"))
+	g := m.Group("/g")
+	g.Use(tag("g"))
+	g.With(tag("w1"), tag("w2")).POST("/c[/:id]", dot)
+	g.GET("/d", dot)
+
+	for _, tt := range []struct{ method, path, want string }{
+		{"GET", "/a", "m."},
+		{"GET", "/b", "mwr1r2."},
+		{"POST", "/g/c", "mgw1w2."},
+		{"POST", "/g/c/1", "mgw1w2."},
+		{"GET", "/g/d", "mg."},
+	} {
+		if got := serve(m, tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	for _, r := range m.Routes() {
+		if r.Pattern == "/b" && !r.Redirect {
+			want := []string{"m", "w", "r1", "r2"}
+			if !reflect.DeepEqual(r.Middlewares, want) {
+				t.Errorf("Routes(): middlewares of /b = %q, want %q", r.Middlewares, want)
+			}
+		}
+	}
+}
+
+func TestGroupSiblings(t *testing.T) {
+	m := mux.New()
+	g := m.Group("/g")
+	g.Use(tag("a"), tag("b"))
+	g.Use(tag("c")) // may leave spare capacity in the slice
+	g1 := g.Group("/1")
+	g2 := g.Group("/2")
+	g1.Use(tag("x"))
+	g2.Use(tag("y"))
+	g1.GET("/", dot)
+	g2.GET("/", dot)
+	g.With(tag("w1")).GET("/w1", dot)
+	g.With(tag("w2")).GET("/w2", dot)
+
+	for _, tt := range []struct{ path, want string }{
+		{"/g/1/", "abcx."},
+		{"/g/2/", "abcy."},
+		{"/g/w1", "abcw1."},
+		{"/g/w2", "abcw2."},
+	} {
+		if got := serve(m, "GET", tt.path); got != tt.want {
+			t.Errorf("GET %s: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUseOrder(t *testing.T) {
+	m := mux.New(mux.Dynamic(true))
+	g := m.Group("/g")
+	n := g.Group("/n")
+	h := m.Host("example.com")
+
+	m.GET("/a", dot)
+	g.GET("/b", dot)
+	n.GET("/c", dot).Use(tag("r"))
+	h.GET("/d", dot)
+
+	// Middlewares added after the routes still apply, in the same order as
+	// if they were added before.
+	n.Use(tag("n"))
+	h.Use(tag("h"))
+	g.Use(tag("g"))
+	m.Use(tag("m1"))
+	m.Use(tag("m2"))
+
+	for _, tt := range []struct{ host, path, want string }{
+		{"", "/a", "m1m2."},
+		{"", "/g/b", "m1m2g."},
+		{"", "/g/n/c", "m1m2gnr."},
+		{"example.com", "/d", "m1m2h."},
+		{"example.com", "/a", "m1m2."},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		m.ServeHTTP(rec, req)
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("GET %s%s: got %q, want %q", tt.host, tt.path, got, tt.want)
+		}
+	}
+
+	var got []string
+	for _, r := range m.Routes() {
+		if r.Pattern == "/g/n/c" && !r.Redirect {
+			got = r.Middlewares
+		}
+	}
+	if want := []string{"m1", "m2", "g", "n", "r"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes(): middlewares of /g/n/c = %q, want %q", got, want)
+	}
+}
+
+// counter is a middleware that counts the calls to Wrap.
+type counter struct{ n *int }
+
+func (c counter) Wrap(h http.Handler) http.Handler {
+	*c.n++
+	return h
+}
+
+func TestUseWrapCount(t *testing.T) {
+	var n int
+	m := mux.New()
+	for i := 0; i < 10; i++ {
+		m.GET(fmt.Sprintf("/%d", i), dot)
+	}
+	for i := 0; i < 5; i++ {
+		m.Use(counter{&n})
+	}
+	if n != 0 {
+		t.Errorf("Wrap called %d times before serving, want 0", n)
+	}
+	serve(m, "GET", "/0")
+	serve(m, "GET", "/1")
+	if n != 50 {
+		t.Errorf("Wrap called %d times, want 50", n)
+	}
+
+	// Routes registered after Use are wrapped once.
+	n = 0
+	m.GET("/x", dot)
+	serve(m, "GET", "/x")
+	if n != 5 {
+		t.Errorf("Wrap called %d times for a new route, want 5", n)
+	}
+}
@@ -0,0 +1,59 @@
+package mux
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headResponseWriter discards the response body of a GET handler serving
+// a HEAD request. The status line is delayed until the handler returns so
+// that Content-Length can be set to the length of the discarded body.
+type headResponseWriter struct {
+	http.ResponseWriter
+	code    int
+	length  int64
+	written bool
+}
+
+func (w *headResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.length += int64(len(b))
+	return len(b), nil
+}
+
+func (w *headResponseWriter) Flush() {
+	w.writeHeader(false)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *headResponseWriter) writeHeader(complete bool) {
+	if w.written {
+		return
+	}
+	w.written = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	header := w.Header()
+	if complete && bodyAllowed(w.code) &&
+		header.Get("Content-Length") == "" &&
+		header.Get("Transfer-Encoding") == "" {
+		header.Set("Content-Length", strconv.FormatInt(w.length, 10))
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != http.StatusNoContent &&
+		code != http.StatusNotModified
+}
@@ -1,31 +1,144 @@
 package mux
 
-import "github.com/fanyang01/httpx/internal/radix"
+import (
+	"fmt"
+
+	"github.com/fanyang01/httpx/internal/radix"
+)
 
 type tree struct {
-	radix.Tree
+	*radix.Tree
 	method string
 }
 
-const nSLOT = 11
+// hmap maps methods to their trees. It uses a perfect hash generated for
+// the set of methods it holds, so a lookup hashes the method once and
+// compares it with a single slot.
+type hmap struct {
+	seed  uint32
+	shift uint32
+	slots []tree
+}
 
-type hmap [nSLOT]tree
+// hash is FNV-1a with an offset basis derived from seed.
+func hash(s string, seed uint32) uint32 {
+	h := 2166136261 ^ seed*0x9e3779b9
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
 
-func hash(s string) byte {
-	b := (s[0] ^ 1) | s[1]
-	return b % nSLOT
+func (h *hmap) get(method string) *radix.Tree {
+	if len(h.slots) == 0 {
+		return nil
+	}
+	if s := &h.slots[hash(method, h.seed)>>h.shift]; s.method == method {
+		return s.Tree
+	}
+	return nil
 }
 
+// Add adds empty trees for methods that are not present, and regenerates
+// the hash function for the new set of methods. Existing trees are kept.
 func (h *hmap) Add(methods ...string) {
-	for _, s := range methods {
-		i := hash(s)
-		if (*h)[i].method != "" {
-			panic("hmap: conflict hash value")
+	trees := h.trees()
+	n := len(trees)
+NEXT:
+	for _, m := range methods {
+		for _, t := range trees {
+			if t.method == m {
+				continue NEXT
+			}
 		}
-		(*h)[i].method = s
+		trees = append(trees, tree{Tree: &radix.Tree{}, method: m})
+	}
+	if len(trees) > n {
+		h.build(trees)
 	}
 }
 
+// trees returns the trees in h.
+func (h *hmap) trees() []tree {
+	var trees []tree
+	for _, s := range h.slots {
+		if s.method != "" {
+			trees = append(trees, s)
+		}
+	}
+	return trees
+}
+
+// maxTries is the number of seeds tried for each table size. A table
+// twice as large as the number of methods usually needs a few tries for a
+// common set of methods.
+const maxTries = 1 << 8
+
+// build finds the smallest table and a seed for which the methods of trees
+// don't collide, and fills the table with trees.
+func (h *hmap) build(trees []tree) {
+	bits := uint32(0)
+	for 1<<bits < len(trees) {
+		bits++
+	}
+	for ; bits <= 16; bits++ {
+		slots := make([]tree, 1<<bits)
+	SEED:
+		for seed := uint32(0); seed < maxTries; seed++ {
+			for i := range slots {
+				slots[i] = tree{}
+			}
+			for _, t := range trees {
+				s := &slots[hash(t.method, seed)>>(32-bits)]
+				if s.method != "" {
+					continue SEED
+				}
+				*s = t
+			}
+			h.seed, h.shift, h.slots = seed, 32-bits, slots
+			return
+		}
+	}
+	panic(fmt.Errorf("mux: can't build the method table for %d methods", len(trees)))
+}
+
+// clone returns a copy of h with the trees cloned by radix.Tree.Clone.
+func (h *hmap) clone(f ...func(old, new *radix.Node)) hmap {
+	c := hmap{seed: h.seed, shift: h.shift, slots: make([]tree, len(h.slots))}
+	for i, s := range h.slots {
+		if s.method != "" {
+			c.slots[i] = tree{Tree: s.Tree.Clone(f...), method: s.method}
+		}
+	}
+	return c
+}
+
+// validMethod reports whether s is a token as defined by RFC 7230.
+func validMethod(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenByte(c byte) bool {
+	switch {
+	case '0' <= c && c <= '9', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return true
+	}
+	switch c {
+	case '!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~':
+		return true
+	}
+	return false
+}
+
 const (
 	xMETHOD = "GET" + "POST" + "PUT" + "HEAD" + "DELETE" + "CONNECT" + "OPTIONS" + "PATCH" + "TRACE"
 )
@@ -46,12 +159,6 @@ var (
 	}
 )
 
-func (mux *Mux) tree(method string) *radix.Tree {
-	if len(method) > 1 {
-		i := hash(method)
-		if mux.hmap[i].method == method {
-			return &mux.hmap[i].Tree
-		}
-	}
-	return mux.extended[method]
+func (t *table) tree(method string) *radix.Tree {
+	return t.hmap.get(method)
 }
@@ -2,6 +2,7 @@ package mux
 
 import (
 	"math/rand"
+	"strconv"
 	"testing"
 
 	"github.com/fanyang01/httpx/internal/radix"
@@ -68,3 +69,46 @@ func BenchmarkMap(b *testing.B) {
 		}
 	})
 }
+
+func TestHmap(t *testing.T) {
+	var h hmap
+	h.Add(xMETHODS...)
+	get := h.get(GET)
+	methods := append([]string(nil), xMETHODS...)
+	methods = append(methods, PROPFIND, PROPPATCH, MKCOL, COPY, MOVE, LOCK, UNLOCK)
+	for i := 0; i < 100; i++ {
+		methods = append(methods, "X-"+strconv.Itoa(i))
+	}
+	for _, m := range methods {
+		h.Add(m)
+	}
+	h.Add(GET, "X-1")
+
+	if got := len(h.trees()); got != len(methods) {
+		t.Errorf("hmap has %d trees, want %d", got, len(methods))
+	}
+	for _, m := range methods {
+		if h.get(m) == nil {
+			t.Errorf("hmap.get(%q) = nil", m)
+		}
+	}
+	for _, m := range []string{"", "G", "get", "X-100", "PROPFINDX"} {
+		if h.get(m) != nil {
+			t.Errorf("hmap.get(%q) != nil", m)
+		}
+	}
+	if h.get(GET) != get {
+		t.Errorf("hmap.Add() moved the tree of GET")
+	}
+}
+
+func TestValidMethod(t *testing.T) {
+	for s, want := range map[string]bool{
+		"GET": true, "PROPFIND": true, "X-Custom_1.0~!": true,
+		"": false, "GET ": false, "A/B": false, "M(": false, "\xff": false,
+	} {
+		if got := validMethod(s); got != want {
+			t.Errorf("validMethod(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
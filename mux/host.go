@@ -0,0 +1,129 @@
+package mux
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// host is a virtual host with its own routes.
+type host struct {
+	pattern string
+	labels  []string
+	mux     *Mux
+}
+
+// Host returns a group whose routes only match requests for the hosts
+// matching pattern. The pattern is a domain name whose labels can be
+// static names, ':name' parameters that match a single label, or a leading
+// '*' that matches one or more labels, e.g. "api.example.com",
+// ":tenant.example.com" or "*.example.com". The port of the request host
+// is ignored. Static patterns take precedence over the other patterns,
+// which are tried in the order of registration.
+//
+// Host parameters are returned by Params before path parameters. Requests
+// that don't match any route of the host are routed by mux as usual.
+// Middlewares added by mux.Use apply to the group.
+func (mux *Mux) Host(pattern string) *Group {
+	pattern = strings.ToLower(pattern)
+	labels := strings.Split(pattern, ".")
+	for i, s := range labels {
+		if s == "" || (s[0] == '*' && (i != 0 || s != "*")) || s == ":" {
+			panic(fmt.Errorf("mux: invalid host pattern %q", pattern))
+		}
+	}
+
+	var h *host
+	mux.update(func() {
+		if h = mux.findHost(pattern); h != nil {
+			return
+		}
+		inherited := append([]Middleware(nil), mux.inherited...)
+		sub := &Mux{
+			table:     newTable(),
+			pathfunc:  mux.pathfunc,
+			inherited: append(inherited, mux.middlewares...),
+			option:    mux.option,
+		}
+		sub.snapshot.Store(sub.table)
+		h = &host{pattern: pattern, labels: labels, mux: sub}
+		if strings.ContainsAny(pattern, ":*") {
+			mux.hostPatterns = append(mux.hostPatterns, h)
+		} else {
+			mux.hosts[pattern] = h
+		}
+	})
+	return &Group{mux: h.mux}
+}
+
+func (t *table) findHost(pattern string) *host {
+	if h, ok := t.hosts[pattern]; ok {
+		return h
+	}
+	for _, h := range t.hostPatterns {
+		if h.pattern == pattern {
+			return h
+		}
+	}
+	return nil
+}
+
+// matchHost returns the virtual host for name and the parameters captured
+// from name.
+func (t *table) matchHost(name string) (*host, ParamList) {
+	if len(t.hosts) == 0 && len(t.hostPatterns) == 0 {
+		return nil, nil
+	}
+	if i := strings.LastIndexByte(name, ':'); i >= 0 &&
+		!strings.Contains(name[i:], "]") {
+		name = name[:i]
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if h, ok := t.hosts[name]; ok {
+		return h, nil
+	}
+	if len(t.hostPatterns) == 0 {
+		return nil, nil
+	}
+	labels := strings.Split(name, ".")
+	for _, h := range t.hostPatterns {
+		if ps, ok := h.match(labels); ok {
+			return h, ps
+		}
+	}
+	return nil, nil
+}
+
+func (h *host) match(labels []string) (ps ParamList, ok bool) {
+	pl := h.labels
+	if pl[0] == "*" {
+		if len(labels) < len(pl) {
+			return nil, false
+		}
+		pl, labels = pl[1:], labels[len(labels)-len(pl)+1:]
+	} else if len(labels) != len(pl) {
+		return nil, false
+	}
+	for i, s := range pl {
+		switch {
+		case s[0] == ':':
+			ps = append(ps, Param{Key: s[1:], Value: labels[i]})
+		case s != labels[i]:
+			return nil, false
+		}
+	}
+	return ps, true
+}
+
+// hostList returns the virtual hosts of t sorted by pattern.
+func (t *table) hostList() []*host {
+	hosts := make([]*host, 0, len(t.hosts)+len(t.hostPatterns))
+	for _, h := range t.hosts {
+		hosts = append(hosts, h)
+	}
+	hosts = append(hosts, t.hostPatterns...)
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].pattern < hosts[j].pattern
+	})
+	return hosts
+}
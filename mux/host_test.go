@@ -0,0 +1,115 @@
+package mux_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fanyang01/httpx/mux"
+)
+
+func TestHost(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(rw, name)
+			for _, p := range mux.Params(req) {
+				fmt.Fprintf(rw, " %s=%s", p.Key, p.Value)
+			}
+		})
+	}
+	m := mux.New()
+	m.GET("/", handler("default"))
+	m.GET("/about", handler("about"))
+	m.Host("api.example.com").GET("/", handler("api"))
+	m.Host(":tenant.example.com").GET("/users/:id", handler("tenant"))
+	m.Host("*.example.org").GET("/", handler("wildcard"))
+
+	tests := []struct {
+		host string
+		path string
+		want string
+	}{
+		{"api.example.com", "/", "api"},
+		{"API.example.com:8080", "/", "api"},
+		{"acme.example.com", "/users/1", "tenant tenant=acme id=1"},
+		{"a.b.example.com", "/users/1", "404 page not found\n"},
+		{"a.example.org", "/", "wildcard"},
+		{"a.b.example.org", "/", "wildcard"},
+		{"example.org", "/", "default"},
+		{"other.com", "/", "default"},
+		// Fall back to the routes of any host.
+		{"api.example.com", "/about", "about"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got response body %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	routes := m.Routes()
+	if got, want := len(routes), 10; got != want {
+		t.Fatalf("got %d routes, want %d", got, want)
+	}
+	for i, want := range []string{"", "", "", "", "*.example.org", "*.example.org",
+		":tenant.example.com", ":tenant.example.com", "api.example.com", "api.example.com"} {
+		if got := routes[i].Host; got != want {
+			t.Errorf("route %d: got host %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestHostMethodFallback(t *testing.T) {
+	m := mux.New()
+	m.Host("api.example.com").GET("/a", dot)
+	m.Host("api.example.com").GET("/b", dot)
+	m.POST("/a", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, "default")
+	}))
+	m.GET("/c/:id", dot)
+	m.Host(":tenant.example.com").POST("/c/:id", dot)
+
+	tests := []struct {
+		method, host, path string
+		code               int
+		body, allow        string
+	}{
+		{"GET", "api.example.com", "/a", 200, ".", ""},
+		{"POST", "api.example.com", "/a", 200, "default", ""},
+		{"POST", "api.example.com", "/b", 405, "", "GET, HEAD, OPTIONS"},
+		{"DELETE", "api.example.com", "/a", 405, "", "GET, HEAD, OPTIONS, POST"},
+		{"GET", "foo.example.com", "/c/1", 200, ".", ""},
+		{"PUT", "foo.example.com", "/c/1", 405, "", "GET, HEAD, OPTIONS, POST"},
+		{"OPTIONS", "foo.example.com", "/c/1", 204, "", "GET, HEAD, OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, req)
+		if rec.Code != tt.code || tt.code == 200 && rec.Body.String() != tt.body ||
+			rec.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s%s: got %v %q Allow %q, want %v %q Allow %q", tt.method, tt.host, tt.path,
+				rec.Code, rec.Body, rec.Header().Get("Allow"), tt.code, tt.body, tt.allow)
+		}
+	}
+}
+
+func TestHostInvalid(t *testing.T) {
+	for _, pattern := range []string{"", "a..com", "a.*.com", "*a.com", ":.com"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Mux.Host(%q): want panic", pattern)
+				}
+			}()
+			mux.New().Host(pattern)
+		}()
+	}
+}
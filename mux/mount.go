@@ -0,0 +1,116 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type originalPathKey struct{}
+
+// Mount forwards requests of any method whose path is prefix or below
+// prefix to h, e.g. another Mux, an http.FileServer or an
+// httputil.ReverseProxy. The prefix is stripped from URL.Path and
+// URL.RawPath, so that h sees "/" for prefix itself, and the original path
+// is available from OriginalPath. The prefix can contain parameters.
+//
+// Routes registered on mux take precedence over mounted handlers, which
+// are wrapped by middlewares like routes are.
+func (mux *Mux) Mount(prefix string, h http.Handler) {
+	mux.mount(nil, prefix, h)
+}
+
+// Mount is like Mux.Mount, but prefix is relative to the prefix of g.
+func (g *Group) Mount(prefix string, h http.Handler) {
+	g.mux.mount(g, concat(g.prefix, prefix), h)
+}
+
+func (mux *Mux) mount(g *Group, prefix string, h http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.update(func() {
+		r := &Route{mux: mux, method: "*", pattern: prefix + "/*"}
+		if g != nil {
+			r.prefix = g.prefix
+		}
+		patterns := []string{r.pattern}
+		if prefix != "" {
+			patterns = append(patterns, prefix)
+		}
+		for _, p := range patterns {
+			node := mux.mounts.Add(p, mux.updateEndpoint)
+			if node.HandlerFunc != nil {
+				panic(fmt.Errorf("mux: prefix %q is already mounted", prefix))
+			}
+			ep := &endpoint{
+				route:   r,
+				pattern: p,
+				group:   g,
+				handler: mux.strip(h, p == r.pattern),
+			}
+			ep.middlewares, ep.gen = mux.chain(g, nil), mux.gen
+			node.Replace(wrap(ep.handler, ep.middlewares).ServeHTTP)
+			mux.endpoint[node] = ep
+		}
+	})
+}
+
+// strip returns a handler that strips the mount prefix from the path of
+// the request before calling h. If rest is true, the stripped path is the
+// last parameter of the request, which is removed.
+func (mux *Mux) strip(h http.Handler, rest bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		p := "/"
+		if rest {
+			ps := Params(req)
+			p += ps[len(ps)-1].Value
+			req = withParams(req, ps[:len(ps)-1])
+		}
+		ctx := req.Context()
+		if _, ok := ctx.Value(originalPathKey{}).(string); !ok {
+			ctx = context.WithValue(ctx, originalPathKey{}, req.URL.Path)
+		}
+
+		u := *req.URL
+		if mux.UseEncodedPath {
+			u.RawPath = p
+			if s, err := url.PathUnescape(p); err == nil {
+				u.Path = s
+			}
+		} else {
+			u.Path, u.RawPath = p, rawSuffix(req.URL, p)
+		}
+		req = req.WithContext(ctx)
+		req.URL = &u
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// rawSuffix returns the suffix of the escaped path of u that is decoded to
+// p if u has a RawPath. Otherwise, it returns an empty string.
+func rawSuffix(u *url.URL, p string) string {
+	if u.RawPath == "" {
+		return ""
+	}
+	raw := u.EscapedPath()
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '/' {
+			continue
+		}
+		if s, err := url.PathUnescape(raw[i:]); err == nil && s == p {
+			return raw[i:]
+		}
+	}
+	return ""
+}
+
+// OriginalPath returns the path of req before the prefix of a mounted
+// handler is stripped. It's the same as req.URL.Path if req isn't routed
+// to a mounted handler.
+func OriginalPath(req *http.Request) string {
+	if p, ok := req.Context().Value(originalPathKey{}).(string); ok {
+		return p
+	}
+	return req.URL.Path
+}
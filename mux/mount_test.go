@@ -0,0 +1,57 @@
+package mux_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fanyang01/httpx/mux"
+)
+
+func TestMount(t *testing.T) {
+	echo := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(rw, "%s %s|%s|%s|%v", req.Method, req.URL.Path,
+			req.URL.RawPath, mux.OriginalPath(req), mux.Params(req))
+	})
+	sub := mux.New()
+	sub.GET("/items/:id", echo)
+
+	m := mux.New()
+	m.Use(tag("m"))
+	m.GET("/static/index.html", dot)
+	m.Mount("/static/", echo)
+	m.Mount("/api", sub)
+	m.Group("/users/:user").Mount("/files", echo)
+
+	for _, tt := range []struct{ method, path, want string }{
+		{"GET", "/static/index.html", "m."},
+		{"POST", "/static/index.html", "mPOST /index.html||/static/index.html|[]"},
+		{"GET", "/static", "mGET /||/static|[]"},
+		{"PROPFIND", "/static/a/b", "mPROPFIND /a/b||/static/a/b|[]"},
+		{"GET", "/static/a%2Fb/c", "mGET /a/b/c|/a%2Fb/c|/static/a/b/c|[]"},
+		{"GET", "/api/items/1", "mGET /items/1||/api/items/1|[{id 1}]"},
+		{"DELETE", "/users/bob/files/x", "mDELETE /x||/users/bob/files/x|[{user bob}]"},
+		{"GET", "/staticx", "404 page not found\n"},
+	} {
+		if got := serve(m, tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	var mounts []string
+	for _, r := range m.Routes() {
+		if r.Method == "*" {
+			mounts = append(mounts, r.Pattern)
+		}
+	}
+	if len(mounts) != 3 {
+		t.Errorf("Routes(): got mounts %q, want 3 of them", mounts)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Mount() of mounted prefix: want panic")
+		}
+	}()
+	m.Mount("/api/", echo)
+}
@@ -3,8 +3,11 @@ package mux
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/fanyang01/httpx/internal/radix"
 )
@@ -19,36 +22,47 @@ const (
 	OPTIONS = "OPTIONS"
 	TRACE   = "TRACE"
 	CONNECT = "CONNECT"
+
+	// WebDAV methods, RFC 4918.
+	PROPFIND  = "PROPFIND"
+	PROPPATCH = "PROPPATCH"
+	MKCOL     = "MKCOL"
+	COPY      = "COPY"
+	MOVE      = "MOVE"
+	LOCK      = "LOCK"
+	UNLOCK    = "UNLOCK"
 )
 
 type Mux struct {
-	hmap        hmap
+	// table is the working copy of the routing state, guarded by mu.
+	*table
+	mu          sync.Mutex
+	snapshot    atomic.Value // *table
 	pathfunc    func(*http.Request) string
 	middlewares []Middleware
-	endpoint    map[*radix.Node]*endpoint
-	combined    radix.Tree
-	link        map[*radix.Node][]*radix.Node
-	extended    map[string]*radix.Tree
+	// inherited are the middlewares of the parent of a virtual host.
+	inherited []Middleware
+	// gen counts the changes of middlewares, and stale reports whether
+	// routes need to be wrapped again by build.
+	gen   int
+	stale atomic.Bool
 	option
 }
 
 func New(options ...Option) *Mux {
 	mux := Mux{
-		endpoint: make(map[*radix.Node]*endpoint),
-		link:     make(map[*radix.Node][]*radix.Node),
-		extended: make(map[string]*radix.Tree),
+		table: newTable(),
 		option: option{
 			StrictSlash:      true,
 			UseEncodedPath:   false,
 			CleanPath:        false,
+			AutoOptions:      true,
+			AutoHead:         true,
 			NotFound:         http.HandlerFunc(http.NotFound),
 			MethodNotAllowed: http.HandlerFunc(MethodNotAllowed),
 		},
 	}
-	mux.hmap.Add(
-		xGET, xPOST, xPUT, xHEAD, xDELETE,
-		xOPTIONS, xPATCH, xTRACE, xCONNECT,
-	)
+	mux.snapshot.Store(mux.table)
 	for _, f := range options {
 		f(&mux)
 	}
@@ -77,39 +91,199 @@ func (mux *Mux) replace(node *radix.Node, f http.HandlerFunc) bool {
 	return replaced
 }
 
-func (mux *Mux) add(method, pattern string, h http.Handler, middlewares ...Middleware) {
+// add registers a route of group g, which is nil for routes registered on
+// mux directly.
+func (mux *Mux) add(method string, g *Group, pattern string, h http.Handler) (r *Route) {
+	mux.update(func() {
+		r = mux.addLocked(method, g, pattern, h)
+	})
+	return r
+}
+
+func (mux *Mux) addLocked(method string, g *Group, pattern string, h http.Handler) *Route {
+	if !validMethod(method) {
+		panic(fmt.Errorf("mux: invalid method %q", method))
+	}
 	t := mux.tree(method)
 	if t == nil {
-		t = &radix.Tree{}
-		mux.extended[method] = t
+		mux.hmap.Add(method)
+		t = mux.tree(method)
+	}
+	r := &Route{mux: mux, method: method, pattern: pattern}
+	if g != nil {
+		r.prefix = g.prefix
 	}
+	if ps := expand(pattern); len(ps) > 1 || ps[0] != pattern {
+		r.patterns = ps
+	}
+	for _, p := range r.expanded() {
+		mux.addPattern(t, r, p, h, g)
+	}
+	return r
+}
 
-	var (
-		node    = t.Add(pattern, mux.updateEndpoint)
-		handler = h
-		mws     = make([]Middleware, 0, len(mux.middlewares)+len(middlewares))
-	)
-	mws = append(mws, mux.middlewares...)
-	mws = append(mws, middlewares...)
+// addPattern registers one of the expanded patterns of r.
+func (mux *Mux) addPattern(t *radix.Tree, r *Route, pattern string,
+	h http.Handler, g *Group) {
 
-	for i := len(mws) - 1; i >= 0; i-- {
-		handler = mws[i].Wrap(handler)
+	mws := mux.chain(g, nil)
+
+	node := t.Add(pattern, mux.updateEndpoint)
+
+	// A redirection added by StrictSlash gives way to a real route.
+	if ep, ok := mux.endpoint[node]; ok && ep.redirect {
+		delete(mux.endpoint, node)
+		node.Replace(nil)
 	}
-	if replaced := mux.replace(node, handler.ServeHTTP); replaced {
+	if replaced := mux.replace(node, wrap(h, mws).ServeHTTP); replaced {
 		panic(fmt.Errorf(
 			"mux: can't override registered pattern: %s %q",
-			method, pattern,
+			r.method, pattern,
 		))
 	}
-	mux.record(method, pattern, h, node, mws)
+	mux.record(r, pattern, h, node, g, mws)
 
 	if mux.StrictSlash && node.Type() != radix.MatchAllNode {
-		mux.redirect(t, pattern)
+		mux.redirect(t, r.method, r.prefix, pattern)
+	}
+}
+
+func wrap(h http.Handler, mws []Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i].Wrap(h)
+	}
+	return h
+}
+
+// chain returns the middlewares wrapping a route of group g with its own
+// middlewares, outermost first.
+func (mux *Mux) chain(g *Group, own []Middleware) []Middleware {
+	var mws []Middleware
+	mws = append(mws, mux.inherited...)
+	mws = append(mws, mux.middlewares...)
+	mws = append(mws, g.chain()...)
+	return append(mws, own...)
+}
+
+// invalidate records that the middlewares of mux changed, which takes
+// effect when mux is next built. Virtual hosts inherit the change.
+func (mux *Mux) invalidate() {
+	mux.gen++
+	mux.stale.Store(true)
+	inherited := append(mux.inherited[:len(mux.inherited):len(mux.inherited)], mux.middlewares...)
+	for _, h := range mux.hostList() {
+		sub := h.mux
+		sub.update(func() {
+			sub.inherited = inherited
+			sub.invalidate()
+		})
+	}
+}
+
+// build wraps the routes registered before the last change of middlewares
+// with their current middlewares. It's deferred until mux serves a request
+// or lists its routes, so that each route is wrapped once however many
+// times Use is called during setup.
+func (mux *Mux) build() {
+	if !mux.stale.Load() {
+		return
+	}
+	mux.update(func() {
+		if !mux.stale.Load() {
+			return
+		}
+		for node, ep := range mux.endpoint {
+			if ep.redirect || ep.gen == mux.gen {
+				continue
+			}
+			ep.middlewares, ep.gen = mux.chain(ep.group, ep.own), mux.gen
+			node.Replace(wrap(ep.handler, ep.middlewares).ServeHTTP)
+		}
+		mux.stale.Store(false)
+	})
+}
+
+// Remove unregisters the route of method and pattern, along with the
+// redirection added for it by StrictSlash. A pattern with optional parts
+// or alternatives removes all of its expansions. It reports whether any
+// route existed.
+func (mux *Mux) Remove(method, pattern string) (removed bool) {
+	mux.update(func() {
+		removed = mux.removeLocked(method, pattern)
+	})
+	return removed
+}
+
+func (mux *Mux) removeLocked(method, pattern string) bool {
+	t := mux.tree(method)
+	if t == nil {
+		return false
+	}
+	removed := false
+	for _, p := range expand(pattern) {
+		if mux.removePattern(t, method, p) {
+			removed = true
+		}
 	}
+	return removed
+}
+
+func (mux *Mux) removePattern(t *radix.Tree, method, pattern string) bool {
+	node := t.Find(pattern)
+	ep, ok := mux.endpoint[node]
+	if !ok || ep.redirect {
+		return false
+	}
+	mux.unrecord(node, ep)
+	t.Remove(pattern, mux.updateEndpoint)
 
+	sibling := toggleSlash(pattern)
+	node = t.Find(sibling)
+	switch ep, ok := mux.endpoint[node]; {
+	case !ok:
+	case ep.redirect:
+		delete(mux.endpoint, node)
+		t.Remove(sibling, mux.updateEndpoint)
+	case mux.StrictSlash && node.Type() != radix.MatchAllNode:
+		// The redirection of the sibling was suppressed by the removed
+		// route.
+		mux.redirect(t, method, ep.route.prefix, sibling)
+	}
+	return true
 }
 
-func (mux *Mux) redirect(t *radix.Tree, pattern string) {
+// Replace replaces the handler of the route of method and pattern, keeping
+// its name and middlewares. The route is registered if it doesn't exist.
+func (mux *Mux) Replace(method, pattern string, h http.Handler) (r *Route) {
+	mux.update(func() {
+		if t := mux.tree(method); t != nil {
+			for _, p := range expand(pattern) {
+				node := t.Find(p)
+				if ep, ok := mux.endpoint[node]; ok && !ep.redirect {
+					ep.handler = h
+					node.Replace(wrap(h, ep.middlewares).ServeHTTP)
+					if r == nil {
+						r = ep.route
+					}
+				}
+			}
+			if r != nil {
+				return
+			}
+		}
+		r = mux.addLocked(method, nil, pattern, h)
+	})
+	return r
+}
+
+func toggleSlash(pattern string) string {
+	if strings.HasSuffix(pattern, "/") {
+		return pattern[:len(pattern)-1]
+	}
+	return pattern + "/"
+}
+
+func (mux *Mux) redirect(t *radix.Tree, method, prefix, pattern string) {
 	var f func(string) string
 
 	if strings.HasSuffix(pattern, "/") {
@@ -120,52 +294,325 @@ func (mux *Mux) redirect(t *radix.Tree, pattern string) {
 		f = func(s string) string { return s[:len(s)-1] }
 	}
 	if node := t.Lookup(pattern); node == nil || node.HandlerFunc == nil {
-		t.Add(pattern, mux.updateEndpoint).Replace(
-			func(w http.ResponseWriter, r *http.Request) {
-				http.Redirect(
-					w, r, f(r.URL.String()), http.StatusMovedPermanently,
-				)
-			},
-		)
+		node = t.Add(pattern, mux.updateEndpoint)
+		node.Replace(func(w http.ResponseWriter, r *http.Request) {
+			p := urlPath(r)
+			if mux.UseEncodedPath {
+				p = encodedPath(r)
+			}
+			http.Redirect(w, r, mux.location(r, f(p)), redirectCode(r))
+		})
+		mux.recordRedirect(&Route{
+			mux: mux, method: method, prefix: prefix, pattern: pattern,
+		}, node)
 	}
 }
 
+// Use adds middlewares to mux. They apply to all routes, including those
+// registered before the call and those of virtual hosts, and wrap the
+// middlewares of groups and routes. Routes registered before the call are
+// wrapped again when mux next serves a request.
 func (mux *Mux) Use(middlewares ...Middleware) {
-	mux.middlewares = append(mux.middlewares, middlewares...)
+	mux.update(func() {
+		mux.middlewares = append(mux.middlewares, middlewares...)
+		mux.invalidate()
+	})
+}
+
+// addAll registers routes of several methods for pattern at once.
+func (mux *Mux) addAll(methods []string, g *Group, pattern string, h http.Handler) (rs []*Route) {
+	if len(methods) == 0 {
+		panic(fmt.Errorf("mux: no method for pattern %q", pattern))
+	}
+	mux.update(func() {
+		seen := make(map[string]bool, len(methods))
+		for _, method := range methods {
+			if !seen[method] {
+				seen[method] = true
+				rs = append(rs, mux.addLocked(method, g, pattern, h))
+			}
+		}
+	})
+	return rs
+}
+
+// anyMethods are the methods registered by Any.
+var anyMethods = []string{
+	GET, HEAD, POST, PUT, PATCH, DELETE, CONNECT, OPTIONS, TRACE,
+}
+
+func (mux *Mux) Handle(method, pattern string, h http.Handler) *Route {
+	return mux.add(method, nil, pattern, h)
+}
+
+func (mux *Mux) HandleFunc(method, pattern string, f http.HandlerFunc) *Route {
+	return mux.add(method, nil, pattern, f)
+}
+
+// Match registers h for pattern and each of methods. Duplicate methods are
+// ignored.
+func (mux *Mux) Match(methods []string, pattern string, h http.Handler) []*Route {
+	return mux.addAll(methods, nil, pattern, h)
+}
+
+// Any registers h for pattern and all the methods defined by RFC 7231 and
+// RFC 5789. Since OPTIONS is included, requests for pattern are never
+// answered by AutoOptions. Use Mount to handle every method, including
+// extension methods.
+func (mux *Mux) Any(pattern string, h http.Handler) []*Route {
+	return mux.addAll(anyMethods, nil, pattern, h)
+}
+
+func (mux *Mux) GET(pattern string, h http.Handler) *Route {
+	return mux.add(xGET, nil, pattern, h)
+}
+
+func (mux *Mux) HEAD(pattern string, h http.Handler) *Route {
+	return mux.add(xHEAD, nil, pattern, h)
+}
+
+func (mux *Mux) POST(pattern string, h http.Handler) *Route {
+	return mux.add(xPOST, nil, pattern, h)
 }
 
-func (mux *Mux) Handle(method, pattern string, h http.Handler) {
-	mux.add(method, pattern, h)
+func (mux *Mux) PUT(pattern string, h http.Handler) *Route {
+	return mux.add(xPUT, nil, pattern, h)
 }
 
-func (mux *Mux) GET(pattern string, h http.Handler) {
-	mux.add(xGET, pattern, h)
+func (mux *Mux) DELETE(pattern string, h http.Handler) *Route {
+	return mux.add(xDELETE, nil, pattern, h)
 }
 
-func (mux *Mux) HEAD(pattern string, h http.Handler) {
-	mux.add(xHEAD, pattern, h)
+func (mux *Mux) PATCH(pattern string, h http.Handler) *Route {
+	return mux.add(xPATCH, nil, pattern, h)
 }
 
-func (mux *Mux) POST(pattern string, h http.Handler) {
-	mux.add(xPOST, pattern, h)
+func (mux *Mux) OPTIONS(pattern string, h http.Handler) *Route {
+	return mux.add(xOPTIONS, nil, pattern, h)
 }
 
-func (mux *Mux) PUT(pattern string, h http.Handler) {
-	mux.add(xPUT, pattern, h)
+func (mux *Mux) TRACE(pattern string, h http.Handler) *Route {
+	return mux.add(xTRACE, nil, pattern, h)
 }
 
-func (mux *Mux) DELETE(pattern string, h http.Handler) {
-	mux.add(xDELETE, pattern, h)
+func (mux *Mux) CONNECT(pattern string, h http.Handler) *Route {
+	return mux.add(xCONNECT, nil, pattern, h)
+}
+
+func (mux *Mux) serve(t *radix.Tree, path string, ps ParamList,
+	rw http.ResponseWriter, req *http.Request) bool {
+
+	node := t.LookupParams(path, &ps)
+	if node == nil || node.HandlerFunc == nil {
+		return false
+	}
+	if len(ps) > 0 {
+		req = withParams(req, ps)
+	}
+	node.HandlerFunc(rw, req)
+	return true
 }
 
 func (mux *Mux) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	if t := mux.tree(req.Method); t != nil {
-		if node := t.Lookup(mux.pathfunc(req)); node != nil && node.HandlerFunc != nil {
-			node.HandlerFunc(rw, req)
-			return
+	mux.build()
+	tab := mux.load()
+	h, ps := tab.matchHost(req.Host)
+	if h == nil {
+		if !mux.route(tab, nil, rw, req, noOthers) {
+			mux.NotFound.ServeHTTP(rw, req)
 		}
-		mux.NotFound.ServeHTTP(rw, req)
 		return
 	}
-	mux.MethodNotAllowed.ServeHTTP(rw, req)
+	// A virtual host answers 405 only if the default routes don't match
+	// either, so that they can serve the methods the host lacks. The Allow
+	// header lists the methods of both.
+	h.mux.build()
+	sub := h.mux.load()
+	if h.mux.route(sub, ps, rw, req, nil) || mux.route(tab, nil, rw, req, nil) {
+		return
+	}
+	fromDefault := func(path string) []string { return mux.allowed(tab, path) }
+	fromHost := func(path string) []string { return h.mux.allowed(sub, path) }
+	if h.mux.route(sub, ps, rw, req, fromDefault) || mux.route(tab, nil, rw, req, fromHost) {
+		return
+	}
+	mux.NotFound.ServeHTTP(rw, req)
+}
+
+// allowFunc returns the methods that routes outside of a table allow for
+// path. They are added to the Allow header when route answers 405 or
+// OPTIONS for a path registered only under other methods. A nil allowFunc
+// keeps route from answering so.
+type allowFunc func(path string) []string
+
+func noOthers(string) []string { return nil }
+
+// route serves req using the routes in tab. It reports false if there is
+// no route for the path of req. Parameters captured from the host are
+// passed in ps.
+func (mux *Mux) route(tab *table, ps ParamList,
+	rw http.ResponseWriter, req *http.Request, allow allowFunc) bool {
+
+	path := mux.pathfunc(req)
+	if mux.routePath(tab, path, ps, rw, req, allow) {
+		return true
+	}
+	if mux.RedirectFixedPath {
+		if fixed := mux.fixPath(tab, req, path); fixed != "" {
+			http.Redirect(rw, req, mux.location(req, fixed), redirectCode(req))
+			return true
+		}
+	}
+	if !mux.CaseInsensitive && !mux.RedirectCase {
+		return false
+	}
+	node, canonical := tab.combined.LookupFold(path, nil)
+	switch {
+	case node == nil || canonical == path:
+		return false
+	case mux.RedirectCase:
+		http.Redirect(rw, req, mux.location(req, canonical), redirectCode(req))
+		return true
+	}
+	return mux.routePath(tab, canonical, ps, rw, req, allow)
+}
+
+// fixPath returns the registered path that p most likely means for the
+// method of req, or an empty string if there is none. It tries, in order,
+// the cleaned p, the cleaned p with its trailing slash added or removed,
+// and both of them with the case of static segments corrected.
+func (mux *Mux) fixPath(tab *table, req *http.Request, p string) string {
+	var trees []*radix.Tree
+	if t := tab.tree(req.Method); t != nil {
+		trees = append(trees, t)
+	}
+	if req.Method == HEAD && mux.AutoHead {
+		if t := tab.tree(GET); t != nil {
+			trees = append(trees, t)
+		}
+	}
+	// A redirection added by StrictSlash doesn't count as a route.
+	route := func(node *radix.Node) bool {
+		ep := tab.endpoint[node]
+		return node != nil && (ep == nil || !ep.redirect)
+	}
+	cleaned := clean(p)
+	candidates := [...]string{cleaned, toggleSlash(cleaned)}
+	for _, c := range candidates {
+		for _, t := range trees {
+			if c != p && route(t.Lookup(c)) {
+				return c
+			}
+		}
+	}
+	for _, c := range candidates {
+		for _, t := range trees {
+			if node, canonical := t.LookupFold(c, nil); route(node) && canonical != p {
+				return canonical
+			}
+		}
+	}
+	return ""
+}
+
+// clean is like path.Clean, but it keeps the trailing slash of p.
+func clean(p string) string {
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+	c := path.Clean(p)
+	if c != "/" && strings.HasSuffix(p, "/") {
+		c += "/"
+	}
+	return c
+}
+
+// redirectCode returns the status code of a permanent redirection of req.
+// Requests other than GET and HEAD are redirected with 308 so that their
+// method and body are kept.
+func redirectCode(req *http.Request) int {
+	if req.Method == GET || req.Method == HEAD {
+		return http.StatusMovedPermanently
+	}
+	return http.StatusPermanentRedirect
+}
+
+// location returns the URL of req with its path replaced by path, which is
+// in the form returned by pathfunc. Leading slashes are collapsed, since a
+// location starting with "//" would refer to another host.
+func (mux *Mux) location(req *http.Request, path string) string {
+	if strings.HasPrefix(path, "//") {
+		path = "/" + strings.TrimLeft(path, "/")
+	}
+	u := url.URL{Path: path, RawQuery: req.URL.RawQuery}
+	if mux.UseEncodedPath {
+		if p, err := url.PathUnescape(path); err == nil {
+			u.Path, u.RawPath = p, path
+		}
+	}
+	return u.RequestURI()
+}
+
+// serveHead serves a HEAD request with the GET route of path.
+func (mux *Mux) serveHead(tab *table, path string, ps ParamList,
+	rw http.ResponseWriter, req *http.Request) bool {
+
+	w := &headResponseWriter{ResponseWriter: rw}
+	if mux.serve(tab.tree(GET), path, ps, w, req) {
+		w.writeHeader(true)
+		return true
+	}
+	return false
+}
+
+// redirects reports whether path matches a redirection added by
+// StrictSlash in tr.
+func (t *table) redirects(tr *radix.Tree, path string) bool {
+	ep := t.endpoint[tr.Lookup(path)]
+	return ep != nil && ep.redirect
+}
+
+// routePath is like route, but it routes path instead of the path of req.
+func (mux *Mux) routePath(tab *table, path string, ps ParamList,
+	rw http.ResponseWriter, req *http.Request, allow allowFunc) bool {
+
+	t := tab.tree(req.Method)
+	autoHead := req.Method == HEAD && mux.AutoHead
+	if autoHead && t != nil && tab.redirects(t, path) {
+		// A redirection added by StrictSlash to the HEAD tree gives way to
+		// the GET route of path.
+		if mux.serveHead(tab, path, ps, rw, req) {
+			return true
+		}
+		autoHead = false
+	}
+	if t != nil && mux.serve(t, path, ps, rw, req) {
+		return true
+	}
+	if autoHead && mux.serveHead(tab, path, ps, rw, req) {
+		return true
+	}
+	if mux.serve(&tab.mounts, path, ps, rw, req) {
+		return true
+	}
+	if allow == nil {
+		return false
+	}
+	// The path may be registered under other methods.
+	if node := tab.combined.Lookup(path); node != nil && node.HandlerFunc != nil {
+		methods := mux.allowed(tab, path)
+		for _, m := range allow(path) {
+			methods = insertSorted(methods, m)
+		}
+		if len(methods) > 0 {
+			if req.Method == OPTIONS && mux.AutoOptions {
+				mux.options(tab, rw, req, path, methods)
+				return true
+			}
+			rw.Header().Set("Allow", strings.Join(methods, ", "))
+			node.HandlerFunc(rw, req)
+			return true
+		}
+	}
+	return false
 }
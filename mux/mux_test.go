@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/fanyang01/httpx/mux"
@@ -61,3 +63,539 @@ func TestMuxMethod(t *testing.T) {
 		})
 	}
 }
+
+func TestParams(t *testing.T) {
+	m := mux.New()
+	m.GET("/users/:id/files/*path", http.HandlerFunc(
+		func(rw http.ResponseWriter, req *http.Request) {
+			ps := mux.Params(req)
+			fmt.Fprint(rw, ps.ByName("id"), " ", ps.ByName("path"), " ", len(ps))
+		},
+	))
+	m.GET("/static", http.HandlerFunc(
+		func(rw http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(rw, mux.Params(req) == nil)
+		},
+	))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users/42/files/a/b.txt", "42 a/b.txt 2"},
+		{"/users/bob/files/", "bob  2"},
+		{"/static", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got response body %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	m := mux.New()
+	for _, r := range []struct{ method, pattern string }{
+		{"GET", "/a"},
+		{"PUT", "/a"},
+		{"DIY", "/a"},
+		{"POST", "/b/:id"},
+		{"GET", "/b/c"},
+	} {
+		m.Handle(r.method, r.pattern, H{t: t, method: r.method})
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"GET", "/a", 200, ""},
+		{"POST", "/a", 405, "DIY, GET, HEAD, OPTIONS, PUT"},
+		{"FOO", "/a", 405, "DIY, GET, HEAD, OPTIONS, PUT"},
+		{"FOO", "/x", 404, ""},
+		{"POST", "/x", 404, ""},
+		{"PUT", "/b/c", 405, "GET, HEAD, OPTIONS, POST"},
+		{"PUT", "/b/d", 405, "OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if got, want := rec.Code, tt.wantStatus; got != want {
+				t.Errorf("got status %v, want %v", got, want)
+			}
+			if got, want := rec.Header().Get("Allow"), tt.wantAllow; got != want {
+				t.Errorf("got Allow header %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAutoHead(t *testing.T) {
+	m := mux.New()
+	m.GET("/a", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("X-Method", req.Method)
+		fmt.Fprint(rw, "hello")
+	}))
+	m.GET("/b", H{t: t, method: "GET"})
+	m.HEAD("/b", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("X-Explicit", "true")
+	}))
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	resp, err := http.Head(server.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, 200; got != want {
+		t.Errorf("got status %v, want %v", got, want)
+	}
+	if got, want := resp.ContentLength, int64(len("hello")); got != want {
+		t.Errorf("got Content-Length %v, want %v", got, want)
+	}
+	if got, want := resp.Header.Get("X-Method"), "HEAD"; got != want {
+		t.Errorf("got X-Method header %q, want %q", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("HEAD", "/a", nil))
+	if rec.Body.Len() != 0 {
+		t.Errorf("got response body %q, want empty", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("HEAD", "/b", nil))
+	if got, want := rec.Header().Get("X-Explicit"), "true"; got != want {
+		t.Errorf("explicit HEAD route: got X-Explicit header %q, want %q", got, want)
+	}
+
+	// The StrictSlash redirection of an explicit HEAD route doesn't hide
+	// the GET route of the path.
+	m.HEAD("/c/", H{t: t, method: "HEAD"})
+	m.GET("/c", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("X-Method", "GET")
+	}))
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("HEAD", "/c", nil))
+	if rec.Code != 200 || rec.Header().Get("X-Method") != "GET" {
+		t.Errorf("HEAD /c: got status %v, X-Method %q, want 200 from GET /c", rec.Code, rec.Header().Get("X-Method"))
+	}
+	m.HEAD("/d/", H{t: t, method: "HEAD"})
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("HEAD", "/d", nil))
+	if got, want := rec.Code, http.StatusMovedPermanently; got != want {
+		t.Errorf("HEAD /d without GET route: got status %v, want %v", got, want)
+	}
+
+	m = mux.New(mux.AutoHead(false))
+	m.GET("/a", H{t: t, method: "GET"})
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("HEAD", "/a", nil))
+	if got, want := rec.Code, 405; got != want {
+		t.Errorf("disabled: got status %v, want %v", got, want)
+	}
+}
+
+func TestDynamic(t *testing.T) {
+	m := mux.New(mux.Dynamic(true))
+	m.GET("/", H{t: t, method: "GET"})
+
+	const n = 100
+	var (
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, path := range []string{"/", "/r/0", "/r/99/x", "/missing"} {
+					rec := httptest.NewRecorder()
+					m.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+					if path == "/" && rec.Code != 200 {
+						t.Errorf("GET /: got status %v, want 200", rec.Code)
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		m.GET("/r/"+strconv.Itoa(i), H{t: t, method: "GET", i: i})
+		m.GET("/r/"+strconv.Itoa(i)+"/:x", H{t: t, method: "GET", i: i})
+		m.POST("/r/"+strconv.Itoa(i), H{t: t, method: "POST", i: i}).Name("r" + strconv.Itoa(i))
+		if i%2 == 1 {
+			m.Remove("POST", "/r/"+strconv.Itoa(i-1))
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", "/r/"+strconv.Itoa(i)+"/x", nil))
+		if got, want := rec.Body.String(), strconv.Itoa(i); got != want {
+			t.Errorf("got response body %v, want %v", got, want)
+		}
+	}
+	// Each route comes with a StrictSlash redirection.
+	if got, want := len(m.Routes()), 2*(1+3*n-n/2); got != want {
+		t.Errorf("got %d routes, want %d", got, want)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m := mux.New()
+	m.GET("/a", H{t: t, method: "GET"}).Name("a")
+	m.POST("/a", H{t: t, method: "POST"})
+	m.GET("/a/b", H{t: t, method: "GET"})
+	m.GET("/c/", H{t: t, method: "GET"})
+	m.GET("/c", H{t: t, method: "GET", i: 1})
+
+	if m.Remove("GET", "/x") {
+		t.Errorf("Mux.Remove() of a missing route = true, want false")
+	}
+	if m.Remove("GET", "/a/") {
+		t.Errorf("Mux.Remove() of a redirection = true, want false")
+	}
+	if !m.Remove("GET", "/a") {
+		t.Errorf("Mux.Remove() = false, want true")
+	}
+	if !m.Remove("GET", "/c/") {
+		t.Errorf("Mux.Remove() = false, want true")
+	}
+	if _, err := m.URL("a"); err == nil {
+		t.Errorf("Mux.URL() of a removed route: want error")
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"GET", "/a", 405, "OPTIONS, POST"},
+		{"GET", "/a/", 404, ""},
+		{"POST", "/a", 200, ""},
+		{"GET", "/a/b", 200, ""},
+		{"GET", "/c", 200, ""},
+		{"GET", "/c/", 301, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if got, want := rec.Code, tt.wantStatus; got != want {
+				t.Errorf("got status %v, want %v", got, want)
+			}
+			if got, want := rec.Header().Get("Allow"), tt.wantAllow; got != want {
+				t.Errorf("got Allow header %q, want %q", got, want)
+			}
+		})
+	}
+
+	m.Remove("POST", "/a")
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("POST", "/a", nil))
+	if got, want := rec.Code, 404; got != want {
+		t.Errorf("got status %v, want %v", got, want)
+	}
+	if got, want := len(m.Routes()), 4; got != want {
+		t.Errorf("got %d routes, want %d: %v", got, want, m.Routes())
+	}
+}
+
+func TestReplace(t *testing.T) {
+	var calls []string
+	m := mux.New()
+	m.Use(mux.MiddlewareFunc(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			calls = append(calls, "middleware")
+			h.ServeHTTP(rw, req)
+		})
+	}))
+	m.GET("/a", H{t: t, method: "GET"}).Name("a")
+	m.GET("/b/", H{t: t, method: "GET"})
+
+	r := m.Replace("GET", "/a", H{t: t, method: "GET", i: 1})
+	if got, want := r.Pattern(), "/a"; got != want {
+		t.Errorf("Route.Pattern() = %q, want %q", got, want)
+	}
+	m.Replace("GET", "/c", H{t: t, method: "GET", i: 2})
+	// Registering the pattern of a redirection replaces the redirection.
+	m.GET("/b", H{t: t, method: "GET", i: 3})
+
+	for path, want := range map[string]string{"/a": "1", "/c": "2", "/b": "3"} {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("GET %s: got response body %v, want %v", path, got, want)
+		}
+	}
+	if got, want := len(calls), 3; got != want {
+		t.Errorf("middleware called %d times, want %d", got, want)
+	}
+	if u, err := m.URL("a"); err != nil || u != "/a" {
+		t.Errorf("Mux.URL() = %q, %v, want %q", u, err, "/a")
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	mux.RegisterConstraint("lower", func(s string) bool {
+		return s != "" && strings.ToLower(s) == s
+	})
+	m := mux.New()
+	m.GET("/users/:id<int>", H{t: t, method: "GET", i: 1})
+	m.GET("/users/:name<lower>", H{t: t, method: "GET", i: 2})
+	m.GET("/users/:other", H{t: t, method: "GET", i: 3})
+
+	for path, want := range map[string]string{
+		"/users/42":  "1",
+		"/users/bob": "2",
+		"/users/Bob": "3",
+	} {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("GET %s: got response body %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	m := mux.New()
+	h := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ps := mux.Params(req)
+		fmt.Fprintf(rw, "%s|%s", ps.ByName("name"), ps.ByName("ext"))
+	})
+	m.GET("/files/:name.:ext", h).Name("file")
+	m.GET("/files/:name", h)
+
+	for path, want := range map[string]string{
+		"/files/a.txt":    "a|txt",
+		"/files/a.tar.gz": "a.tar|gz",
+		"/files/README":   "README|",
+	} {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("GET %s: got response body %v, want %v", path, got, want)
+		}
+	}
+	u, err := m.URL("file", "name", "a b", "ext", "txt")
+	if want := "/files/a%20b.txt"; err != nil || u != want {
+		t.Errorf("URL() = %q, %v, want %q", u, err, want)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	for _, redirect := range []bool{false, true} {
+		m := mux.New(mux.CaseInsensitive(!redirect), mux.RedirectCase(redirect))
+		m.GET("/Users/:name", H{t: t, method: "GET", i: 1})
+		m.GET("/posts/new", H{t: t, method: "GET", i: 2})
+		m.GET("/:a/Evil.com", H{t: t, method: "GET", i: 3})
+
+		tests := []struct {
+			method, path string
+			code         int
+			body         string
+			location     string
+		}{
+			{"GET", "/posts/new", 200, "2", ""},
+			{"GET", "/Users/Bob", 200, "1", ""},
+			{"GET", "/POSTS/New", 200, "2", "/posts/new"},
+			{"GET", "/users/Bob?x=1", 200, "1", "/Users/Bob?x=1"},
+			{"POST", "/Posts/new", 405, "", "/posts/new"},
+			{"GET", "/people/bob", 404, "", ""},
+			// Not a redirection to another host.
+			{"GET", "//evil.com", 200, "3", "/Evil.com"},
+		}
+		for _, tt := range tests {
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			code, location := tt.code, ""
+			if redirect && tt.location != "" {
+				code, location = http.StatusMovedPermanently, tt.location
+				if tt.method != "GET" {
+					code = http.StatusPermanentRedirect
+				}
+			}
+			if rec.Code != code {
+				t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rec.Code, code)
+			}
+			if got := rec.Header().Get("Location"); got != location {
+				t.Errorf("%s %s: got location %q, want %q", tt.method, tt.path, got, location)
+			}
+			if code == 200 && rec.Body.String() != tt.body {
+				t.Errorf("%s %s: got response body %v, want %v",
+					tt.method, tt.path, rec.Body.String(), tt.body)
+			}
+		}
+	}
+}
+
+func TestStrictSlashRedirect(t *testing.T) {
+	m := mux.New()
+	m.GET("/a", H{t: t, method: "GET"})
+	m.POST("/b/", H{t: t, method: "POST"})
+	m.GET("/:c/:d", H{t: t, method: "GET"})
+
+	tests := []struct {
+		method, path string
+		code         int
+		location     string
+	}{
+		{"GET", "/a/?x=1", http.StatusMovedPermanently, "/a?x=1"},
+		{"POST", "/b?x=1", http.StatusPermanentRedirect, "/b/?x=1"},
+		// Not a redirection to another host.
+		{"GET", "//evil.com/", http.StatusMovedPermanently, "/evil.com"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s %s: got location %q, want %q", tt.method, tt.path, got, tt.location)
+		}
+	}
+}
+
+func TestRedirectFixedPath(t *testing.T) {
+	m := mux.New(mux.StrictSlash(false), mux.RedirectFixedPath(true))
+	m.GET("/a/b", H{t: t, method: "GET"})
+	m.POST("/Users/:name/", H{t: t, method: "POST"})
+
+	tests := []struct {
+		method, path string
+		code         int
+		location     string
+	}{
+		{"GET", "/a/b", 200, ""},
+		{"GET", "/a//b?x=1", http.StatusMovedPermanently, "/a/b?x=1"},
+		{"HEAD", "/a/./c/../b", http.StatusMovedPermanently, "/a/b"},
+		{"GET", "/a/b/", http.StatusMovedPermanently, "/a/b"},
+		{"GET", "/A/B/", http.StatusMovedPermanently, "/a/b"},
+		{"POST", "/users/bob", http.StatusPermanentRedirect, "/Users/bob/"},
+		{"POST", "/users/../Users/a%20b/", http.StatusPermanentRedirect, "/Users/a%20b/"},
+		{"GET", "/a/c", 404, ""},
+		{"HEAD", "/A/B/", http.StatusMovedPermanently, "/a/b"},
+		// Only routes of the method of the request are redirected to.
+		{"POST", "/a//b", 404, ""},
+		{"GET", "/users/bob", 404, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s %s: got location %q, want %q", tt.method, tt.path, got, tt.location)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	m := mux.New()
+	rs := m.Match([]string{"GET", "POST", "GET"}, "/a", dot)
+	if len(rs) != 2 {
+		t.Fatalf("Match() returned %d routes, want 2", len(rs))
+	}
+	m.Any("/b", dot)
+	g := m.Group("/g")
+	g.Match([]string{"PUT", "PATCH"}, "/c", dot)
+	g.HandleFunc("TRACE", "/c", dot)
+	m.PATCH("/d", dot)
+	g.OPTIONS("/d", dot)
+
+	tests := []struct {
+		method, path string
+		code         int
+		allow        string
+	}{
+		{"GET", "/a", 200, ""},
+		{"POST", "/a", 200, ""},
+		{"PUT", "/a", 405, "GET, HEAD, OPTIONS, POST"},
+		{"CONNECT", "/b", 200, ""},
+		{"OPTIONS", "/b", 200, ""},
+		{"PROPFIND", "/b", 405, "CONNECT, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE"},
+		{"PATCH", "/g/c", 200, ""},
+		{"TRACE", "/g/c", 200, ""},
+		{"GET", "/g/c", 405, "OPTIONS, PATCH, PUT, TRACE"},
+		{"PATCH", "/d", 200, ""},
+		{"OPTIONS", "/g/d", 200, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", tt.method, tt.path, got, tt.allow)
+		}
+	}
+
+	m.Remove("POST", "/a")
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("POST", "/a", nil))
+	if got, want := rec.Header().Get("Allow"), "GET, HEAD, OPTIONS"; got != want {
+		t.Errorf("POST /a after Remove: got Allow %q, want %q", got, want)
+	}
+}
+
+func TestExtensionMethod(t *testing.T) {
+	m := mux.New(mux.Dynamic(true))
+	m.Handle(mux.PROPFIND, "/dav/*path", dot)
+	m.Handle(mux.MKCOL, "/dav/*path", dot)
+	m.Handle("X-PURGE", "/cache", dot)
+
+	tests := []struct {
+		method, path string
+		code         int
+		allow        string
+	}{
+		{"PROPFIND", "/dav/a", 200, ""},
+		{"MKCOL", "/dav/a/b", 200, ""},
+		{"X-PURGE", "/cache", 200, ""},
+		{"LOCK", "/dav/a", 405, "MKCOL, OPTIONS, PROPFIND"},
+		{"GET", "/cache", 405, "OPTIONS, X-PURGE"},
+		{"X-PURGE", "/dav/a", 405, "MKCOL, OPTIONS, PROPFIND"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", tt.method, tt.path, got, tt.allow)
+		}
+	}
+
+	for _, method := range []string{"", "BAD METHOD", "A/B"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Handle(%q): want panic", method)
+				}
+			}()
+			m.Handle(method, "/x", dot)
+		}()
+	}
+}
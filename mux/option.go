@@ -3,11 +3,17 @@ package mux
 import "net/http"
 
 type option struct {
-	StrictSlash      bool
-	UseEncodedPath   bool
-	CleanPath        bool
-	NotFound         http.Handler
-	MethodNotAllowed http.Handler
+	StrictSlash       bool
+	UseEncodedPath    bool
+	CleanPath         bool
+	AutoOptions       bool
+	AutoHead          bool
+	Dynamic           bool
+	CaseInsensitive   bool
+	RedirectCase      bool
+	RedirectFixedPath bool
+	NotFound          http.Handler
+	MethodNotAllowed  http.Handler
 }
 
 type Option func(*Mux)
@@ -32,6 +38,53 @@ func CleanPath(value bool) Option {
 	return func(mux *Mux) { mux.CleanPath = value }
 }
 
+// AutoOptions controls whether OPTIONS requests to a path without an
+// explicit OPTIONS route are answered with 204 and the Allow header. The
+// CORS policy of the requested route, if any, answers preflight requests.
+func AutoOptions(value bool) Option {
+	return func(mux *Mux) { mux.AutoOptions = value }
+}
+
+// AutoHead controls whether HEAD requests to a path without an explicit
+// HEAD route are served by the GET route of the path. The response body
+// is discarded.
+func AutoHead(value bool) Option {
+	return func(mux *Mux) { mux.AutoHead = value }
+}
+
+// Dynamic controls whether routes can be registered while the mux is
+// serving requests. In dynamic mode, every registration copies the routing
+// table, so it's slower and should not be used for large static route
+// tables. Requests are routed without locking in both modes.
+func Dynamic(value bool) Option {
+	return func(mux *Mux) { mux.Dynamic = value }
+}
+
+// CaseInsensitive controls whether requests whose paths differ from a
+// registered pattern only in the ASCII case of static segments are served
+// by the route of the pattern. Exact matches are always preferred. Static
+// text in parameter segments, such as ".pdf" in ":name.pdf", is still
+// matched exactly.
+func CaseInsensitive(value bool) Option {
+	return func(mux *Mux) { mux.CaseInsensitive = value }
+}
+
+// RedirectCase is like CaseInsensitive, but such requests are redirected
+// to the path spelled as it is registered instead of being served.
+func RedirectCase(value bool) Option {
+	return func(mux *Mux) { mux.RedirectCase = value }
+}
+
+// RedirectFixedPath controls whether a request whose path has no route is
+// redirected to a registered path that differs from it only in "." and
+// ".." elements, repeated slashes, a trailing slash or the case of static
+// segments. Unlike CleanPath, the client sees the canonical URL. The query
+// string is kept, and requests other than GET and HEAD are redirected with
+// 308 so that their method and body are kept.
+func RedirectFixedPath(value bool) Option {
+	return func(mux *Mux) { mux.RedirectFixedPath = value }
+}
+
 func MethodNotAllowed(rw http.ResponseWriter, req *http.Request) {
 	code := http.StatusMethodNotAllowed
 	http.Error(rw, http.StatusText(code), code)
@@ -0,0 +1,50 @@
+package mux
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fanyang01/httpx/internal/radix"
+)
+
+// Param is a path parameter captured by a ':name' or '*name' segment.
+// Parameters can appear anywhere in a segment, as in ':name.:ext', so a
+// ':' in a pattern always starts a parameter, whose name starts with a
+// letter or '_'. A literal ':' is written as '::', as in '/time/12::30'.
+type Param = radix.Param
+
+// ParamList is an ordered list of path parameters. Values captured by
+// '*name' segments don't include the leading slash.
+type ParamList = radix.Params
+
+type paramsKey struct{}
+
+func withParams(req *http.Request, ps ParamList) *http.Request {
+	ctx := context.WithValue(req.Context(), paramsKey{}, ps)
+	return req.WithContext(ctx)
+}
+
+// Params returns the path parameters matched for req, in the order they
+// appear in the pattern.
+func Params(req *http.Request) ParamList {
+	ps, _ := req.Context().Value(paramsKey{}).(ParamList)
+	return ps
+}
+
+// RegisterConstraint registers a named constraint for path parameters. A
+// constraint is given in angle brackets after the parameter name, e.g.
+// "/users/:id<int>". It can be the name of a registered constraint or a
+// regular expression that must match the whole segment, e.g.
+// "/posts/:slug<[a-z-]+>". The built-in constraints are int, uint, alpha,
+// alnum, hex and uuid. A constraint can't contain '/', which a parameter
+// never matches.
+//
+// Parameters with constraints take precedence over parameters without
+// constraints at the same position, so several of them can be registered
+// for the same position if their constraints differ. Constraints must be
+// registered before the patterns using them: a constraint that looks like a
+// name but isn't registered panics, and a regular expression matching a
+// name literally is written in parentheses, as in ":v<(beta)>".
+func RegisterConstraint(name string, f func(string) bool) {
+	radix.RegisterConstraint(name, f)
+}
@@ -0,0 +1,126 @@
+package mux
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fanyang01/httpx/internal/radix"
+)
+
+// expand returns the patterns described by pattern, which can contain
+// optional parts in square brackets and alternatives in braces, e.g.
+// "/docs[/:page]" and "/api/{v1|v2}/items". Parts can be nested. Patterns
+// with an optional part come before those without it, alternatives keep
+// their order, and duplicates are removed. Constraints such as
+// ":id<[0-9]{4}>" are copied verbatim.
+func expand(pattern string) []string {
+	if !strings.ContainsAny(pattern, "[]{}|") {
+		return []string{pattern}
+	}
+	e := expander{pattern: pattern}
+	ps := e.sequence()
+	if e.i < len(pattern) {
+		e.fail("unexpected %q", pattern[e.i])
+	}
+
+	seen := make(map[string]bool, len(ps))
+	patterns := ps[:0]
+	for _, p := range ps {
+		if !seen[p] {
+			seen[p] = true
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+type expander struct {
+	pattern string
+	i       int
+}
+
+func (e *expander) fail(format string, args ...interface{}) {
+	panic(fmt.Errorf(
+		"mux: invalid pattern %q: %s", e.pattern, fmt.Sprintf(format, args...),
+	))
+}
+
+// sequence parses the pattern until the end of it or of the enclosing
+// part, and returns all the alternatives.
+func (e *expander) sequence() []string {
+	ps := []string{""}
+	for e.i < len(e.pattern) {
+		var alts []string
+		switch s := e.pattern; s[e.i] {
+		case ']', '}', '|':
+			return ps
+		case '[':
+			e.i++
+			alts = append(e.sequence(), "")
+			e.expect(']')
+		case '{':
+			e.i++
+			alts = e.sequence()
+			for e.i < len(s) && s[e.i] == '|' {
+				e.i++
+				alts = append(alts, e.sequence()...)
+			}
+			e.expect('}')
+		default:
+			alts = []string{e.literal()}
+		}
+		ps = product(ps, alts)
+	}
+	return ps
+}
+
+func (e *expander) expect(c byte) {
+	if e.i == len(e.pattern) || e.pattern[e.i] != c {
+		e.fail("missing %q", c)
+	}
+	e.i++
+}
+
+// literal consumes text up to the next special byte. The constraint of a
+// parameter is consumed as a whole.
+func (e *expander) literal() string {
+	s, start := e.pattern, e.i
+	for e.i < len(s) && !strings.ContainsRune("[]{}|", rune(s[e.i])) {
+		if strings.HasPrefix(s[e.i:], "::") {
+			e.i += 2
+			continue
+		}
+		if s[e.i] != ':' {
+			e.i++
+			continue
+		}
+		for e.i++; e.i < len(s) && radix.IsNameByte(s[e.i]); e.i++ {
+		}
+		if e.i < len(s) && s[e.i] == '<' {
+			for depth := 0; e.i < len(s); e.i++ {
+				if s[e.i] == '<' {
+					depth++
+				} else if s[e.i] == '>' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			if e.i == len(s) {
+				e.fail("unterminated constraint")
+			}
+			e.i++
+		}
+	}
+	return s[start:e.i]
+}
+
+func product(ps, alts []string) []string {
+	res := make([]string, 0, len(ps)*len(alts))
+	for _, p := range ps {
+		for _, a := range alts {
+			res = append(res, p+a)
+		}
+	}
+	return res
+}
@@ -0,0 +1,110 @@
+package mux_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fanyang01/httpx/mux"
+)
+
+func TestOptionalPattern(t *testing.T) {
+	m := mux.New(mux.StrictSlash(false))
+	h := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, mux.Params(req))
+	})
+	m.GET("/docs[/:page]", h).Name("docs")
+	m.GET("/api/{v1|v2}/items[/:id<int>]", h).Name("items")
+	m.GET("/re/:id<[0-9]{2}>", h)
+
+	for path, want := range map[string]string{
+		"/docs":           "[]",
+		"/docs/intro":     "[{page intro}]",
+		"/api/v1/items":   "[]",
+		"/api/v2/items/7": "[{id 7}]",
+		"/re/42":          "[{id 42}]",
+		"/api/v3/items":   "404 page not found\n",
+	} {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("GET %s: got response body %q, want %q", path, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		params []string
+		want   string
+	}{
+		{"docs", nil, "/docs"},
+		{"docs", []string{"page", "a"}, "/docs/a"},
+		{"items", nil, "/api/v1/items"},
+		{"items", []string{"id", "3"}, "/api/v1/items/3"},
+	} {
+		if got, err := m.URL(tt.name, tt.params...); err != nil || got != tt.want {
+			t.Errorf("Mux.URL(%q, %q) = %q, %v, want %q",
+				tt.name, tt.params, got, err, tt.want)
+		}
+	}
+	if _, err := m.URL("docs", "other", "a"); err == nil {
+		t.Errorf("Mux.URL() with unknown parameter: want error")
+	}
+
+	var items mux.RouteInfo
+	for _, r := range m.Routes() {
+		if r.Name == "items" {
+			items = r
+		}
+	}
+	want := mux.RouteInfo{
+		Method:  "GET",
+		Pattern: "/api/{v1|v2}/items[/:id<int>]",
+		Patterns: []string{
+			"/api/v1/items/:id<int>", "/api/v1/items",
+			"/api/v2/items/:id<int>", "/api/v2/items",
+		},
+		Name: "items",
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("Mux.Routes() = %+v, want %+v", items, want)
+	}
+
+	if !m.Remove("GET", "/api/{v1|v2}/items[/:id<int>]") {
+		t.Errorf("Mux.Remove() = false")
+	}
+	if len(m.Routes()) != 2 {
+		t.Errorf("Mux.Routes() = %+v, want 2 routes", m.Routes())
+	}
+	if _, err := m.URL("items"); err == nil {
+		t.Errorf("Mux.URL() of removed route: want error")
+	}
+	m.Remove("GET", "/docs")
+	if got, err := m.URL("docs"); err == nil {
+		t.Errorf("Mux.URL() = %q, want error", got)
+	}
+	if got, err := m.URL("docs", "page", "b"); err != nil || got != "/docs/b" {
+		t.Errorf("Mux.URL() = %q, %v, want %q", got, err, "/docs/b")
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	for _, p := range []string{
+		"/docs[/:page",
+		"/docs/:page]",
+		"/api/{v1|v2",
+		"/api/v1|v2}",
+		"/re/:id<[0-9]{2}",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("GET %q: want panic", p)
+				}
+			}()
+			mux.New().GET(p, http.NotFoundHandler())
+		}()
+	}
+}
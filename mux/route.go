@@ -0,0 +1,253 @@
+package mux
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/fanyang01/httpx/internal/radix"
+)
+
+// Route is a handle of a registered route.
+type Route struct {
+	mux     *Mux
+	method  string
+	prefix  string
+	pattern string
+	// patterns are the expansions of pattern if it has optional parts or
+	// alternatives.
+	patterns []string
+	name     string
+}
+
+func (r *Route) Method() string { return r.method }
+
+// Pattern returns the pattern the route was registered with, before its
+// optional parts and alternatives are expanded.
+func (r *Route) Pattern() string { return r.pattern }
+
+func (r *Route) expanded() []string {
+	if r.patterns != nil {
+		return r.patterns
+	}
+	return []string{r.pattern}
+}
+
+// Use wraps the handler of the route with middlewares. They are the
+// innermost ones: a request passes through the middlewares added by
+// Mux.Use, then those of the groups from the outermost one, then those
+// given to With, and finally those given to Use in the order they are
+// added.
+func (r *Route) Use(middlewares ...Middleware) *Route {
+	mux := r.mux
+	mux.update(func() {
+		t := mux.tree(r.method)
+		for _, p := range mux.registered(r) {
+			node := t.Find(p)
+			ep := mux.endpoint[node]
+			ep.own = append(ep.own[:len(ep.own):len(ep.own)], middlewares...)
+			ep.middlewares, ep.gen = mux.chain(ep.group, ep.own), mux.gen
+			node.Replace(wrap(ep.handler, ep.middlewares).ServeHTTP)
+		}
+	})
+	return r
+}
+
+// Name names the route so that its URL can be built by Mux.URL. It panics
+// if the name is already used by another route.
+func (r *Route) Name(name string) *Route {
+	mux := r.mux
+	mux.update(func() {
+		if other, ok := mux.names[name]; ok && other != r {
+			panic(fmt.Errorf(
+				"mux: route name %q is already used by %s %q",
+				name, other.method, other.pattern,
+			))
+		}
+		if r.name != "" {
+			delete(mux.names, r.name)
+		}
+		r.name = name
+		mux.names[name] = r
+	})
+	return r
+}
+
+// URL builds the path of the route named name. The parameters are given
+// as key-value pairs, e.g. URL("file", "user", "bob", "path", "a/b.txt").
+// Values of ':name' parameters are escaped as a single path segment, while
+// slashes in values of '*name' segments are preserved.
+//
+// If the pattern of the route has optional parts or alternatives, the
+// first expansion that uses exactly the given parameters is built.
+//
+// Routes of virtual hosts are searched if mux has no route named name.
+func (mux *Mux) URL(name string, params ...string) (string, error) {
+	mux.mu.Lock()
+	var (
+		r, ok    = mux.names[name]
+		hosts    = mux.hostList()
+		patterns []string
+	)
+	if ok {
+		patterns = mux.registered(r)
+	}
+	mux.mu.Unlock()
+	if !ok {
+		for _, h := range hosts {
+			h.mux.mu.Lock()
+			_, named := h.mux.names[name]
+			h.mux.mu.Unlock()
+			if named {
+				return h.mux.URL(name, params...)
+			}
+		}
+		return "", fmt.Errorf("mux: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("mux: odd number of parameters for route %q", name)
+	}
+	for i := 0; i < len(params); i += 2 {
+		for j := 0; j < i; j += 2 {
+			if params[i] == params[j] {
+				return "", fmt.Errorf(
+					"mux: duplicate parameter %q for route %q", params[i], name,
+				)
+			}
+		}
+	}
+
+	var first error
+	for _, pattern := range patterns {
+		u, err := build(name, pattern, params)
+		if err == nil {
+			return u, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return "", first
+}
+
+func build(name, pattern string, params []string) (string, error) {
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	path, err := radix.Expand(pattern, func(key string, all bool) (string, error) {
+		v, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf(
+				"mux: missing parameter %q for route %q", key, name,
+			)
+		}
+		delete(values, key)
+		if !all {
+			return url.PathEscape(v), nil
+		}
+		vs := strings.Split(v, "/")
+		for j := range vs {
+			vs[j] = url.PathEscape(vs[j])
+		}
+		return strings.Join(vs, "/"), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for k := range values {
+		return "", fmt.Errorf("mux: unknown parameter %q for route %q", k, name)
+	}
+	return path, nil
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	// Host is the pattern of the virtual host, or empty for the routes
+	// that match any host.
+	Host string
+	// Method is "*" for handlers added by Mount.
+	Method  string
+	Pattern string
+	// Patterns are the registered expansions of Pattern if it has optional
+	// parts or alternatives.
+	Patterns []string
+	// Prefix is the prefix of the group the route was registered on.
+	Prefix string
+	Name   string
+	// Middlewares are the names of the middlewares wrapping the handler,
+	// outermost first. See MiddlewareName.
+	Middlewares []string
+	// Redirect reports whether the route was added by StrictSlash.
+	Redirect bool
+}
+
+// Routes returns all registered routes, sorted by pattern and then method.
+// Routes of virtual hosts follow, sorted by host pattern.
+func (mux *Mux) Routes() []RouteInfo {
+	mux.build()
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	routes := mux.routes()
+	for _, h := range mux.hostList() {
+		for _, r := range h.mux.Routes() {
+			r.Host = h.pattern
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+func (mux *Mux) routes() []RouteInfo {
+	var (
+		routes = make([]RouteInfo, 0, len(mux.endpoint))
+		seen   = make(map[*Route]bool, len(mux.endpoint))
+	)
+	for _, ep := range mux.endpoint {
+		if seen[ep.route] {
+			continue
+		}
+		seen[ep.route] = true
+		info := RouteInfo{
+			Method:   ep.route.method,
+			Pattern:  ep.route.pattern,
+			Prefix:   ep.route.prefix,
+			Name:     ep.route.name,
+			Redirect: ep.redirect,
+		}
+		if ep.route.patterns != nil {
+			info.Patterns = mux.registered(ep.route)
+		}
+		for _, m := range ep.middlewares {
+			info.Middlewares = append(info.Middlewares, MiddlewareName(m))
+		}
+		routes = append(routes, info)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// MiddlewareName returns a human-readable name of m. It's the result of
+// the Name or String method if m has one, the function name if m is a
+// MiddlewareFunc, or the type name otherwise.
+func MiddlewareName(m Middleware) string {
+	switch v := m.(type) {
+	case interface{ Name() string }:
+		return v.Name()
+	case fmt.Stringer:
+		return v.String()
+	case MiddlewareFunc:
+		if f := runtime.FuncForPC(reflect.ValueOf(v).Pointer()); f != nil {
+			return f.Name()
+		}
+	}
+	return fmt.Sprintf("%T", m)
+}
@@ -0,0 +1,108 @@
+package mux_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fanyang01/httpx/mux"
+)
+
+func TestURL(t *testing.T) {
+	m := mux.New()
+	h := H{t: t, method: "GET"}
+	m.GET("/", h).Name("home")
+	m.GET("/users/:id", h).Name("user")
+	m.GET("/posts/:id<int>", h).Name("post")
+	m.Group("/users/:id").GET("/files/*path", h).Name("file")
+	m.Host("api.example.com").GET("/items/:id", h).Name("item")
+
+	tests := []struct {
+		name    string
+		params  []string
+		want    string
+		wantErr bool
+	}{
+		{"home", nil, "/", false},
+		{"user", []string{"id", "42"}, "/users/42", false},
+		{"user", []string{"id", "a b/c"}, "/users/a%20b%2Fc", false},
+		{"file", []string{"id", "1", "path", "a/b c.txt"}, "/users/1/files/a/b%20c.txt", false},
+		{"post", []string{"id", "7"}, "/posts/7", false},
+		{"user", nil, "", true},
+		{"user", []string{"id"}, "", true},
+		{"user", []string{"id", "1", "id", "2"}, "", true},
+		{"user", []string{"id", "1", "extra", "2"}, "", true},
+		{"unknown", nil, "", true},
+		{"item", []string{"id", "3"}, "/items/3", false},
+		{"item", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.URL(tt.name, tt.params...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Mux.URL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && tt.name != "unknown" && strings.Contains(err.Error(), "no route named") {
+				t.Errorf("Mux.URL() error = %v, want the error of route %q", err, tt.name)
+			}
+			if got != tt.want {
+				t.Errorf("Mux.URL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteName(t *testing.T) {
+	m := mux.New()
+	r := m.POST("/a", H{t: t, method: "POST"}).Name("a")
+	if got, want := r.Method(), "POST"; got != want {
+		t.Errorf("Route.Method() = %q, want %q", got, want)
+	}
+	if got, want := r.Pattern(), "/a"; got != want {
+		t.Errorf("Route.Pattern() = %q, want %q", got, want)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate route name: want panic")
+		}
+	}()
+	m.GET("/b", H{t: t, method: "GET"}).Name("a")
+}
+
+type named struct{}
+
+func (named) Name() string                     { return "named" }
+func (named) Wrap(h http.Handler) http.Handler { return h }
+
+func logging(h http.Handler) http.Handler { return h }
+
+func TestRoutes(t *testing.T) {
+	m := mux.New()
+	m.Use(mux.MiddlewareFunc(logging))
+	h := H{t: t, method: "GET"}
+	m.GET("/a", h).Name("a")
+	g := m.Group("/api")
+	g.Use(named{}, &mux.CORS{})
+	g.POST("/items/", h)
+
+	want := []mux.RouteInfo{
+		{
+			Method: "GET", Pattern: "/a", Name: "a",
+			Middlewares: []string{"github.com/fanyang01/httpx/mux_test.logging"},
+		},
+		{Method: "GET", Pattern: "/a/", Redirect: true},
+		{Method: "POST", Pattern: "/api/items", Prefix: "/api", Redirect: true},
+		{
+			Method: "POST", Pattern: "/api/items/", Prefix: "/api",
+			Middlewares: []string{
+				"github.com/fanyang01/httpx/mux_test.logging",
+				"named",
+				"*mux.CORS",
+			},
+		},
+	}
+	if got := m.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Mux.Routes() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package mux
+
+import (
+	"github.com/fanyang01/httpx/internal/radix"
+)
+
+// table is the routing state of a Mux. ServeHTTP reads the latest published
+// table without locking. In dynamic mode, a published table is never
+// modified: writers modify a copy and publish it when they are done.
+type table struct {
+	hmap     hmap
+	endpoint map[*radix.Node]*endpoint
+	combined radix.Tree
+	// mounts holds the mounted handlers for any method.
+	mounts  radix.Tree
+	link    map[*radix.Node][]*radix.Node
+	methods []string
+	names   map[string]*Route
+	// Virtual hosts with static names and with patterns.
+	hosts        map[string]*host
+	hostPatterns []*host
+}
+
+func newTable() *table {
+	t := &table{
+		endpoint: make(map[*radix.Node]*endpoint),
+		link:     make(map[*radix.Node][]*radix.Node),
+		names:    make(map[string]*Route),
+		hosts:    make(map[string]*host),
+	}
+	t.hmap.Add(
+		xGET, xPOST, xPUT, xHEAD, xDELETE,
+		xOPTIONS, xPATCH, xTRACE, xCONNECT,
+	)
+	return t
+}
+
+// clone returns a deep copy of t that shares nothing mutable with t.
+func (t *table) clone() *table {
+	var (
+		c     = newTable()
+		moved = make(map[*radix.Node]*radix.Node)
+		f     = func(old, new *radix.Node) { moved[old] = new }
+	)
+	c.hmap = t.hmap.clone(f)
+	c.combined = *t.combined.Clone(f)
+	c.mounts = *t.mounts.Clone(f)
+
+	for n, ep := range t.endpoint {
+		e := *ep
+		e.combined = moved[ep.combined]
+		c.endpoint[moved[n]] = &e
+	}
+	for cn, nodes := range t.link {
+		ns := make([]*radix.Node, len(nodes))
+		for i, n := range nodes {
+			ns[i] = moved[n]
+		}
+		c.link[moved[cn]] = ns
+	}
+	c.methods = append([]string(nil), t.methods...)
+	for name, r := range t.names {
+		c.names[name] = r
+	}
+	for name, h := range t.hosts {
+		c.hosts[name] = h
+	}
+	c.hostPatterns = append([]*host(nil), t.hostPatterns...)
+	return c
+}
+
+// update runs f, which modifies mux.table, with the write lock held and
+// publishes the result. In dynamic mode, f modifies a copy of the current
+// table, which is discarded if f panics.
+func (mux *Mux) update(f func()) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	old := mux.table
+	if mux.Dynamic {
+		mux.table = old.clone()
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			mux.table = old
+			panic(e)
+		}
+	}()
+	f()
+	mux.snapshot.Store(mux.table)
+}
+
+func (mux *Mux) load() *table {
+	return mux.snapshot.Load().(*table)
+}